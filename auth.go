@@ -0,0 +1,87 @@
+package chatty
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+// StatusError is returned when the server answered a request with an
+// error status, so callers can tell a bad password from a network failure.
+type StatusError struct {
+	Status int
+	Reason string
+}
+
+func (e * StatusError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Status, e.Reason)
+}
+
+// PostCredentials sends the credentials to one of the server's auth
+// endpoints.
+func PostCredentials(ctx context.Context, server Server, path string, credentials protocol.Credentials) (protocol.TokenResponse, error) {
+
+	token:= protocol.TokenResponse{}
+
+	raw, err:= json.Marshal(credentials)
+
+	if err != nil {
+		return token, err
+	}
+
+	req, err:= http.NewRequestWithContext(ctx, http.MethodPost, server.HTTPURL(path), bytes.NewReader(raw))
+
+	if err != nil {
+		return token, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err:= server.httpClient().Do(req)
+
+	if err != nil {
+		return token, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+
+		reason, _:= io.ReadAll(io.LimitReader(res.Body, 256))
+
+		return token, &StatusError{Status: res.StatusCode, Reason: strings.TrimSpace(string(reason))}
+	}
+
+	if err:= json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return token, err
+	}
+
+	return token, nil
+}
+
+// Login exchanges a username and password for a chat token. Accounts are
+// only ever created by Register.
+func Login(ctx context.Context, server Server, user string, password string) (protocol.TokenResponse, error) {
+
+	return LoginWith(ctx, server, protocol.Credentials{
+		Username: user,
+		Password: password,
+	})
+}
+
+// LoginWith is Login with the rest of the credentials, such as a colour to
+// save to the user's profile.
+func LoginWith(ctx context.Context, server Server, credentials protocol.Credentials) (protocol.TokenResponse, error) {
+	return PostCredentials(ctx, server, "/login", credentials)
+}
+
+// Register creates an account with the credentials and logs into it.
+func Register(ctx context.Context, server Server, credentials protocol.Credentials) (protocol.TokenResponse, error) {
+	return PostCredentials(ctx, server, "/register", credentials)
+}
@@ -0,0 +1,272 @@
+package chatty
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait bounds a Send whose context has no deadline.
+	writeWait = 10 * time.Second
+	// closeWait is how long Close waits for the server to answer its close.
+	closeWait = time.Second
+	eventBuffer = 64
+)
+
+// Client is one connection to the server as User.
+type Client struct {
+	User string
+	// Hello is what the server said it supports. A server from before the
+	// handshake shows up as version 0 with no features.
+	Hello protocol.HelloMessage
+	conn * websocket.Conn
+	writeMux sync.Mutex
+	events chan protocol.Message
+	done chan struct{}
+	readDone chan struct{}
+	closeOnce sync.Once
+	err error
+}
+
+// Dial opens a connection for user with a token from Login and says hello.
+// If the server refuses the upgrade the error is a *StatusError; if it
+// refuses our protocol version, Refused reports why.
+func Dial(ctx context.Context, server Server, user string, token string) (* Client, error) {
+
+	header:= http.Header{}
+
+	header.Set("Authorization", "Bearer "+token)
+
+	conn, res, err:= server.dialer().DialContext(ctx, server.URL("/chat/"+user), header)
+
+	if err != nil {
+
+		if res != nil {
+			return nil, &StatusError{Status: res.StatusCode, Reason: err.Error()}
+		}
+
+		return nil, err
+	}
+
+	client:= &Client{
+		User: user,
+		conn: conn,
+		events: make(chan protocol.Message, eventBuffer),
+		done: make(chan struct{}),
+		readDone: make(chan struct{}),
+	}
+
+	first, err:= client.handshake(ctx)
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go client.read(first)
+
+	return client, nil
+}
+
+// handshake sends our hello and waits for the server's. An older server
+// sends something else first, which is handed back to deliver as an event.
+func (c * Client) handshake(ctx context.Context) (protocol.Message, error) {
+
+	if err:= c.Send(ctx, protocol.Hello()); err != nil {
+		return nil, err
+	}
+
+	deadline, ok:= ctx.Deadline()
+
+	if !ok {
+		deadline = time.Now().Add(writeWait)
+	}
+
+	if err:= c.conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	for {
+
+		_, raw, err:= c.conn.ReadMessage()
+
+		if err != nil {
+			return nil, err
+		}
+
+		msg, err:= protocol.Decode(raw)
+
+		if err != nil {
+			continue
+		}
+
+		if hello, ok:= msg.(protocol.HelloMessage); ok {
+			c.Hello = hello
+			return nil, nil
+		}
+
+		return msg, nil
+	}
+}
+
+// Supports reports whether the server said it has feature.
+func (c * Client) Supports(feature string) bool {
+	return c.Hello.Supports(feature)
+}
+
+// read decodes frames into events until the connection ends, starting
+// with first if the handshake left one over. Frame types this version
+// does not know are skipped.
+func (c * Client) read(first protocol.Message){
+
+	defer close(c.readDone)
+	defer close(c.events)
+
+	if first != nil {
+		c.events <- first
+	}
+
+	for {
+
+		_, raw, err:= c.conn.ReadMessage()
+
+		if err != nil {
+
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				c.err = err
+			}
+
+			return
+		}
+
+		msg, err:= protocol.Decode(raw)
+
+		if err != nil {
+			continue
+		}
+
+		select {
+		case c.events <- msg:
+		case <- c.done:
+		}
+	}
+}
+
+// Events delivers every message the server sends, in order. It is closed
+// when the connection ends; Err then says why.
+func (c * Client) Events() <-chan protocol.Message {
+	return c.events
+}
+
+// Err is why the connection ended, or nil if it was closed normally. It is
+// only meaningful once Events is closed.
+func (c * Client) Err() error {
+	return c.err
+}
+
+// Send writes msg to the server. It gives up when ctx is done or, if ctx
+// has no deadline, after writeWait.
+func (c * Client) Send(ctx context.Context, msg protocol.Message) error {
+
+	if err:= ctx.Err(); err != nil {
+		return err
+	}
+
+	frame, err:= protocol.Wrap(msg)
+
+	if err != nil {
+		return err
+	}
+
+	deadline, ok:= ctx.Deadline()
+
+	if !ok {
+		deadline = time.Now().Add(writeWait)
+	}
+
+	c.writeMux.Lock()
+
+	defer c.writeMux.Unlock()
+
+	if err:= c.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+
+	return c.conn.WriteJSON(frame)
+}
+
+// Close says goodbye to the server, waits briefly for it to answer, then
+// drops the connection. Events are no longer delivered once it is called.
+func (c * Client) Close() error {
+
+	var err error
+
+	c.closeOnce.Do(func(){
+
+		close(c.done)
+
+		c.writeMux.Lock()
+		err = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(closeWait))
+		c.writeMux.Unlock()
+
+		select {
+		case <- c.readDone:
+		case <- time.After(closeWait):
+		}
+
+		if closeErr:= c.conn.Close(); err == nil {
+			err = closeErr
+		}
+	})
+
+	if errors.Is(err, websocket.ErrCloseSent) || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// Refused reports whether err is the server ending the connection for
+// good, such as another device taking over the session or our protocol
+// version being too old, with the reason it gave. Reconnecting after that would only fail again.
+func Refused(err error) (string, bool) {
+
+	closeErr:= new(websocket.CloseError)
+
+	if !errors.As(err, &closeErr) {
+		return "", false
+	}
+
+	switch closeErr.Code {
+
+	case protocol.CloseSessionExists, protocol.CloseSessionReplaced, protocol.CloseUnsupportedVersion:
+		return closeErr.Text, true
+	}
+
+	return "", false
+}
+
+// NewChat builds a message from from to a friend or a room, with a fresh
+// client id so the server can drop it if it has to be sent again.
+func NewChat(from string, to string, room string, text string, color int) protocol.ChatMessage {
+
+	return protocol.ChatMessage{
+		ClientID: uuid.NewString(),
+		SentAt: time.Now().UnixMilli(),
+		To: to,
+		Room: room,
+		From: from,
+		Text: text,
+		Color: color,
+	}
+}
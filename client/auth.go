@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/Ikenna-Okpala/chatty"
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+type AuthMsg struct{
+	Token string
+	Color int
+}
+
+// AuthFailedMsg means the server turned the credentials down, and the
+// user may try again.
+type AuthFailedMsg struct{
+	Reason string
+}
+
+// Login exchanges a username and password for a chat token and our colour,
+// or creates the account first if register is set. A color other than 0
+// replaces the one on our profile.
+func Login(whoAmI string, password string, color int, register bool) tea.Cmd {
+
+	return func() tea.Msg {
+
+		login:= chatty.LoginWith
+
+		if register {
+			login = chatty.Register
+		}
+
+		token, err:= login(context.Background(), server, protocol.Credentials{
+			Username: whoAmI,
+			Password: password,
+			Color: color,
+		})
+
+		statusErr:= new(chatty.StatusError)
+
+		if errors.As(err, &statusErr) && statusErr.Status < http.StatusInternalServerError {
+			return AuthFailedMsg{Reason: statusErr.Reason}
+		}
+
+		if err != nil {
+			return ErrorMsg{err: err}
+		}
+
+		return AuthMsg{Token: token.Token, Color: token.Color}
+	}
+}
+
+// SubmitPassword logs in with the password typed, or registers with it.
+func (m * Model) SubmitPassword(register bool) tea.Cmd {
+
+	m.CurrWindow = 1
+	m.Notice = ""
+
+	password:= m.Password.Value()
+
+	m.Password.Reset()
+	m.Password.Blur()
+
+	login:= Login(m.WhoAmI, password, m.ChosenTheme, register)
+
+	if !m.Reconnecting {
+		return login
+	}
+
+	// Logging in again after the token expired: losing the network now
+	// should not throw away what is queued, so it only asks again.
+	return func() tea.Msg {
+
+		msg:= login()
+
+		if err, ok:= msg.(ErrorMsg); ok {
+			return AuthFailedMsg{Reason: err.Error()}
+		}
+
+		return msg
+	}
+}
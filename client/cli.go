@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/Ikenna-Okpala/chatty"
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+// sendTimeout bounds how long `chatty send` waits for the server's ack.
+const sendTimeout = 10 * time.Second
+
+// Options are the command-line settings beyond where the server is.
+type Options struct {
+	User string
+	Password string
+	To string
+	Room string
+	Headless bool
+	Theme int
+	LogFile string
+	Notify string
+	Register bool
+}
+
+const usage = `usage:
+  chatty [flags]                  open the chat UI
+  chatty send [flags] --to user message...
+                                  send one message and exit
+  chatty -headless [flags] --to user|--room room
+                                  send each stdin line, print incoming
+                                  messages to stdout as JSON lines
+
+flags:
+`
+
+// ParseArgs splits args into a subcommand, options and what is left,
+// which for send is the message. It also applies the connection config.
+func ParseArgs(args [] string) (string, Options, [] string, error) {
+
+	options:= Options{}
+	command:= ""
+
+	if len(args) > 0 && args[0] == "send" {
+		command = args[0]
+		args = args[1:]
+	}
+
+	if err:= LoadEnv(); err != nil {
+		return command, options, nil, err
+	}
+
+	theme, _:= strconv.Atoi(envOr("CHATTY_THEME", "0"))
+
+	fs:= flag.NewFlagSet("chatty", flag.ContinueOnError)
+
+	fs.Usage = func(){
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&options.User, "user", envOr("CHATTY_USER", ""), "username, skipping the prompt (CHATTY_USER)")
+	fs.StringVar(&options.To, "to", "", "friend to open a DM with, or to send to")
+	fs.StringVar(&options.Room, "room", "", "room to send to in headless mode")
+	fs.BoolVar(&options.Register, "register", false, "create the account instead of logging in")
+	fs.BoolVar(&options.Headless, "headless", false, "no UI: send stdin lines, print incoming messages as JSON lines")
+	fs.IntVar(&options.Theme, "theme", theme, "your colour, 1-255, saved to your profile; the server picks one if never set (CHATTY_THEME)")
+	fs.StringVar(&options.LogFile, "log-file", envOr("CHATTY_LOG_FILE", ""), "append debug logs to this file (CHATTY_LOG_FILE)")
+	fs.StringVar(&options.Notify, "notify", envOr("CHATTY_NOTIFY", NotifyOff), "on messages for other chats: off, bell, osc9 or osc777 (CHATTY_NOTIFY)")
+
+	config.RegisterFlags(fs)
+
+	if err:= fs.Parse(args); err != nil {
+		return command, options, nil, err
+	}
+
+	// Flags may come before the subcommand too.
+	if command == "" && fs.Arg(0) == "send" {
+		command = "send"
+
+		if err:= fs.Parse(fs.Args()[1:]); err != nil {
+			return command, options, nil, err
+		}
+	}
+
+	if options.Theme < 0 || options.Theme > 255 {
+		return command, options, nil, fmt.Errorf("Theme %d is not a colour between 1 and 255", options.Theme)
+	}
+
+	if !slices.Contains(notifyKinds, options.Notify) {
+		return command, options, nil, fmt.Errorf("Unknown notification %q, expected one of %s", options.Notify, strings.Join(notifyKinds, ", "))
+	}
+
+	options.Password = os.Getenv("CHATTY_PASSWORD")
+
+	return command, options, fs.Args(), config.Apply()
+}
+
+// InitLogger sends log output to path. The UI owns the terminal, so
+// without a log file logs are dropped.
+func InitLogger(path string) error {
+
+	if path == ""{
+		log.SetOutput(io.Discard)
+		return nil
+	}
+
+	file, err:= os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+
+	if err != nil {
+		return err
+	}
+
+	log.SetOutput(file)
+
+	return nil
+}
+
+// ReadPassword takes the password from CHATTY_PASSWORD, or asks for it
+// when stdin is a terminal.
+func ReadPassword(options Options) (string, error) {
+
+	if options.Password != ""{
+		return options.Password, nil
+	}
+
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return "", errors.New("No password, set CHATTY_PASSWORD")
+	}
+
+	fmt.Fprintf(os.Stderr, "Password for %s: ", options.User)
+
+	password, err:= term.ReadPassword(os.Stdin.Fd())
+
+	fmt.Fprintln(os.Stderr)
+
+	return string(password), err
+}
+
+// WaitAck reads events until the server acks or rejects the message sent
+// as clientID.
+func WaitAck(client * chatty.Client, clientID string) error {
+
+	timeout:= time.NewTimer(sendTimeout)
+
+	defer timeout.Stop()
+
+	for {
+
+		select {
+
+		case event, ok:= <- client.Events():
+
+			if !ok {
+				return closedError(client)
+			}
+
+			switch event:= event.(type) {
+
+			case protocol.AckMessage:
+				if event.ClientID == clientID {
+					return nil
+				}
+
+			case protocol.ErrorMessage:
+				if event.Type == protocol.TypeChat && (event.ClientID == "" || event.ClientID == clientID) {
+					return errors.New(event.Message)
+				}
+
+			case protocol.RateLimitedMessage:
+				if event.Type == protocol.TypeChat && (event.ClientID == "" || event.ClientID == clientID) {
+					return fmt.Errorf("Rate limited, try again in %s", time.Duration(event.RetryAfter) * time.Millisecond)
+				}
+			}
+
+		case <- timeout.C:
+			return errors.New("Timed out waiting for the server")
+		}
+	}
+}
+
+// Open logs in as options.User and connects, the way the UI does but
+// without it.
+func Open(options Options) (* chatty.Client, error) {
+
+	if options.User == ""{
+		return nil, errors.New("Needs --user or CHATTY_USER")
+	}
+
+	password, err:= ReadPassword(options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	login:= chatty.LoginWith
+
+	if options.Register {
+		login = chatty.Register
+	}
+
+	token, err:= login(context.Background(), server, protocol.Credentials{
+		Username: options.User,
+		Password: password,
+		Color: options.Theme,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return chatty.Dial(context.Background(), server, options.User, token.Token)
+}
+
+// RunSend logs in, sends text to options.To and waits for the server to
+// store it.
+func RunSend(options Options, text string) error {
+
+	if options.To == ""{
+		return errors.New("send needs --to")
+	}
+
+	if strings.TrimSpace(text) == ""{
+		return errors.New("Nothing to send")
+	}
+
+	client, err:= Open(options)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	// The server stamps our colour on it.
+	chat:= chatty.NewChat(options.User, options.To, "", text, options.Theme)
+
+	if err:= client.Send(context.Background(), chat); err != nil {
+		return err
+	}
+
+	if err:= WaitAck(client, chat.ClientID); err != nil {
+		return err
+	}
+
+	return client.Close()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestParseArgs(t * testing.T){
+
+	tests:= [] struct {
+		name string
+		args [] string
+		env map[string] string
+		command string
+		options Options
+		rest [] string
+		fails bool
+	}{
+		{
+			name: "ui",
+			args: [] string{},
+			options: Options{Notify: NotifyOff},
+		},
+		{
+			name: "send first",
+			args: [] string{"send", "-user", "amy", "-to", "bob", "hello", "there"},
+			command: "send",
+			options: Options{User: "amy", To: "bob", Notify: NotifyOff},
+			rest: [] string{"hello", "there"},
+		},
+		{
+			name: "send after flags",
+			args: [] string{"-user", "amy", "send", "-to", "bob", "hello"},
+			command: "send",
+			options: Options{User: "amy", To: "bob", Notify: NotifyOff},
+			rest: [] string{"hello"},
+		},
+		{
+			name: "register",
+			args: [] string{"-user", "amy", "-register", "-theme", "198"},
+			options: Options{User: "amy", Register: true, Theme: 198, Notify: NotifyOff},
+		},
+		{
+			name: "env",
+			args: [] string{"-notify", "bell"},
+			env: map[string] string{"CHATTY_USER": "amy", "CHATTY_PASSWORD": "pw", "CHATTY_THEME": "42"},
+			options: Options{User: "amy", Password: "pw", Theme: 42, Notify: NotifyBell},
+		},
+		{
+			name: "theme too high",
+			args: [] string{"-theme", "256"},
+			fails: true,
+		},
+		{
+			name: "theme negative",
+			args: [] string{"-theme", "-1"},
+			fails: true,
+		},
+		{
+			name: "unknown notify",
+			args: [] string{"-notify", "siren"},
+			fails: true,
+		},
+		{
+			name: "unknown notify from env",
+			env: map[string] string{"CHATTY_NOTIFY": "siren"},
+			fails: true,
+		},
+		{
+			name: "unknown flag",
+			args: [] string{"-colour", "3"},
+			fails: true,
+		},
+		{
+			name: "bad server",
+			args: [] string{"-server", "ftp://chat.example.com"},
+			fails: true,
+		},
+	}
+
+	savedConfig, savedServer:= config, server
+
+	t.Cleanup(func(){ config, server = savedConfig, savedServer })
+
+	for _, test:= range tests{
+
+		t.Run(test.name, func(t * testing.T){
+
+			// No .env, and none of the caller's settings.
+			t.Chdir(t.TempDir())
+
+			for _, name:= range [] string{"CHATTY_USER", "CHATTY_PASSWORD", "CHATTY_THEME", "CHATTY_NOTIFY", "CHATTY_LOG_FILE", "CHATTY_HOST", "CHATTY_SCHEME", "CHATTY_CA_FILE", "CHATTY_INSECURE"}{
+
+				// Setenv restores the variable afterwards, even once unset.
+				t.Setenv(name, "")
+				os.Unsetenv(name)
+			}
+
+			for name, value:= range test.env{
+				t.Setenv(name, value)
+			}
+
+			config = Config{Host: defaultHost, Scheme: "wss"}
+
+			command, options, rest, err:= ParseArgs(test.args)
+
+			if test.fails {
+
+				if err == nil {
+					t.Fatalf("ParseArgs(%q) succeeded with %+v, want an error", test.args, options)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if command != test.command {
+				t.Errorf("command = %q, want %q", command, test.command)
+			}
+
+			if options != test.options {
+				t.Errorf("options = %+v, want %+v", options, test.options)
+			}
+
+			if len(rest) + len(test.rest) > 0 && !slices.Equal(rest, test.rest) {
+				t.Errorf("rest = %q, want %q", rest, test.rest)
+			}
+		})
+	}
+}
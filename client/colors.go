@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/Ikenna-Okpala/chatty/protocol"
+	"github.com/muesli/termenv"
+)
+
+// defaultTheme colours the login screen, until the server tells us our
+// own colour.
+const defaultTheme = 39
+
+// minContrast is the least contrast a colour may have against the
+// terminal's background before we draw it in a nearby colour instead.
+const minContrast = 3
+
+// background is the luminance of the terminal's background, black until
+// DetectBackground finds out.
+var background = 0.0
+
+// readable caches Readable, which is asked for every line on every frame.
+var readable = make(map[int] int)
+
+// DetectBackground asks the terminal for its background colour. It has to
+// run before the UI starts reading keys, or the answer is read as typing.
+func DetectBackground(){
+
+	r, g, b:= termenv.ConvertToRGB(lipgloss.DefaultRenderer().Output().BackgroundColor()).RGB255()
+
+	background = protocol.Luminance(r, g, b)
+
+	clear(readable)
+}
+
+// Readable is color, or if it is too close to the background to read, the
+// colour nearest to it that is not.
+func Readable(color int) int {
+
+	if !protocol.ValidColor(color) {
+		return color
+	}
+
+	if c, ok:= readable[color]; ok {
+		return c
+	}
+
+	best:= color
+
+	if protocol.Contrast(protocol.ColorLuminance(color), background) < minContrast {
+
+		r, g, b:= protocol.RGB(color)
+
+		nearest:= math.MaxInt
+
+		// The first 16 colours are left out, terminals draw them as they
+		// please.
+		for candidate:= 16; candidate <= protocol.MaxColor; candidate++ {
+
+			if protocol.Contrast(protocol.ColorLuminance(candidate), background) < minContrast {
+				continue
+			}
+
+			cr, cg, cb:= protocol.RGB(candidate)
+
+			dr, dg, db:= int(r) - int(cr), int(g) - int(cg), int(b) - int(cb)
+
+			if d:= dr * dr + dg * dg + db * db; d < nearest {
+				nearest = d
+				best = candidate
+			}
+		}
+	}
+
+	readable[color] = best
+
+	return best
+}
+
+// Foreground is a colour for lipgloss, made readable.
+func Foreground(color int) lipgloss.Color {
+	return lipgloss.Color(strconv.Itoa(Readable(color)))
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Ikenna-Okpala/chatty"
+	"github.com/joho/godotenv"
+)
+
+const defaultHost = "server-divine-log-7849.fly.dev"
+
+// Config says where the server is and how to reach it. Every field can be
+// set with a flag, or with the env var named in its flag's help, which is
+// also read from a .env file in the working directory.
+type Config struct {
+	Host string
+	Scheme string
+	CAFile string
+	Insecure bool
+}
+
+var (
+	config = Config{Host: defaultHost, Scheme: "wss"}
+	server = chatty.Server{Host: defaultHost, Scheme: "wss"}
+)
+
+func envOr(name string, fallback string) string {
+
+	if value, ok:= os.LookupEnv(name); ok {
+		return value
+	}
+
+	return fallback
+}
+
+// RegisterFlags adds the connection flags to fs, defaulting each to its
+// env var.
+func (c * Config) RegisterFlags(fs * flag.FlagSet){
+
+	insecure, _:= strconv.ParseBool(envOr("CHATTY_INSECURE", strconv.FormatBool(c.Insecure)))
+
+	fs.Func("server", "server URL, e.g. ws://localhost:8080; sets -host and -scheme", c.SetServer)
+	fs.StringVar(&c.Host, "host", envOr("CHATTY_HOST", c.Host), "server host[:port] (CHATTY_HOST)")
+	fs.StringVar(&c.Scheme, "scheme", envOr("CHATTY_SCHEME", c.Scheme), "ws for a plain local server, wss otherwise (CHATTY_SCHEME)")
+	fs.StringVar(&c.CAFile, "ca-file", envOr("CHATTY_CA_FILE", c.CAFile), "PEM bundle of extra CAs to trust (CHATTY_CA_FILE)")
+	fs.BoolVar(&c.Insecure, "insecure-skip-verify", insecure, "do not verify the server's certificate (CHATTY_INSECURE)")
+}
+
+func (c Config) TLSConfig() (*tls.Config, error) {
+
+	tlsConfig:= &tls.Config{InsecureSkipVerify: c.Insecure}
+
+	if c.CAFile == ""{
+		return tlsConfig, nil
+	}
+
+	pem, err:= os.ReadFile(c.CAFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err:= x509.SystemCertPool()
+
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in %s", c.CAFile)
+	}
+
+	tlsConfig.RootCAs = pool
+
+	return tlsConfig, nil
+}
+
+// Apply validates the config and points server at it.
+func (c Config) Apply() error {
+
+	if c.Host == ""{
+		return errors.New("No server host, pass -host or set CHATTY_HOST")
+	}
+
+	if c.Scheme != "ws" && c.Scheme != "wss" {
+		return fmt.Errorf("Unknown scheme %q, expected ws or wss", c.Scheme)
+	}
+
+	if _, err:= url.Parse(c.Scheme + "://" + c.Host); err != nil {
+		return fmt.Errorf("Invalid host %q: %w", c.Host, err)
+	}
+
+	tlsConfig, err:= c.TLSConfig()
+
+	if err != nil {
+		return err
+	}
+
+	server = chatty.Server{
+		Host: c.Host,
+		Scheme: c.Scheme,
+		TLSConfig: tlsConfig,
+	}
+
+	return nil
+}
+
+// LoadEnv reads .env, if there is one. It has to run before flags are
+// registered, since their defaults come from the environment.
+func LoadEnv() error {
+
+	if err:= godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// SetServer takes a server URL such as wss://chat.example.com or
+// ws://localhost:8080, or a bare host.
+func (c * Config) SetServer(raw string) error {
+
+	if !strings.Contains(raw, "://") {
+		c.Host = raw
+		return nil
+	}
+
+	u, err:= url.Parse(raw)
+
+	if err != nil {
+		return err
+	}
+
+	switch u.Scheme {
+
+	case "ws", "http":
+		c.Scheme = "ws"
+
+	case "wss", "https":
+		c.Scheme = "wss"
+
+	default:
+		return fmt.Errorf("Unknown scheme %q, expected ws or wss", u.Scheme)
+	}
+
+	c.Host = u.Host
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigSetServer(t * testing.T){
+
+	tests:= [] struct {
+		raw string
+		host string
+		scheme string
+		fails bool
+	}{
+		{raw: "localhost:8080", host: "localhost:8080", scheme: "wss"},
+		{raw: "ws://localhost:8080", host: "localhost:8080", scheme: "ws"},
+		{raw: "http://localhost:8080", host: "localhost:8080", scheme: "ws"},
+		{raw: "wss://chat.example.com", host: "chat.example.com", scheme: "wss"},
+		{raw: "https://chat.example.com/ignored", host: "chat.example.com", scheme: "wss"},
+		{raw: "ftp://chat.example.com", fails: true},
+		{raw: "ws://[::1", fails: true},
+	}
+
+	for _, test:= range tests{
+
+		t.Run(test.raw, func(t * testing.T){
+
+			c:= Config{Host: defaultHost, Scheme: "wss"}
+
+			err:= c.SetServer(test.raw)
+
+			if test.fails {
+
+				if err == nil {
+					t.Fatalf("SetServer(%q) succeeded with %+v, want an error", test.raw, c)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.Host != test.host || c.Scheme != test.scheme {
+				t.Errorf("SetServer(%q) gave %s://%s, want %s://%s", test.raw, c.Scheme, c.Host, test.scheme, test.host)
+			}
+		})
+	}
+}
+
+func TestConfigApply(t * testing.T){
+
+	missing:= filepath.Join(t.TempDir(), "missing.pem")
+
+	notPEM:= filepath.Join(t.TempDir(), "ca.pem")
+
+	if err:= os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests:= [] struct {
+		name string
+		config Config
+		fails bool
+	}{
+		{name: "default", config: Config{Host: defaultHost, Scheme: "wss"}},
+		{name: "local", config: Config{Host: "localhost:8080", Scheme: "ws"}},
+		{name: "insecure", config: Config{Host: "localhost:8443", Scheme: "wss", Insecure: true}},
+		{name: "no host", config: Config{Scheme: "wss"}, fails: true},
+		{name: "bad scheme", config: Config{Host: defaultHost, Scheme: "https"}, fails: true},
+		{name: "bad host", config: Config{Host: "local host:80%", Scheme: "ws"}, fails: true},
+		{name: "missing ca file", config: Config{Host: defaultHost, Scheme: "wss", CAFile: missing}, fails: true},
+		{name: "empty ca file", config: Config{Host: defaultHost, Scheme: "wss", CAFile: notPEM}, fails: true},
+	}
+
+	saved:= server
+
+	t.Cleanup(func(){ server = saved })
+
+	for _, test:= range tests{
+
+		t.Run(test.name, func(t * testing.T){
+
+			server.Host = "untouched"
+
+			err:= test.config.Apply()
+
+			if test.fails {
+
+				if err == nil {
+					t.Fatalf("Apply succeeded for %+v, want an error", test.config)
+				}
+
+				if server.Host != "untouched" {
+					t.Errorf("a failed Apply still pointed server at %s", server.Host)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if server.Host != test.config.Host || server.Scheme != test.config.Scheme {
+				t.Errorf("server is %s://%s, want %s://%s", server.Scheme, server.Host, test.config.Scheme, test.config.Host)
+			}
+
+			if server.TLSConfig == nil || server.TLSConfig.InsecureSkipVerify != test.config.Insecure {
+				t.Errorf("TLSConfig = %+v, want InsecureSkipVerify %v", server.TLSConfig, test.config.Insecure)
+			}
+		})
+	}
+}
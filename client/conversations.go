@@ -0,0 +1,379 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+// Conversation is the scrollback of one DM or room, and how it was left.
+type Conversation struct {
+	Friend Friend
+	Room string
+	Messages [] Line
+	// Typing points at the indicator line of each friend typing here.
+	Typing map[string] *TypeInfo
+	// Offset is how far the view was scrolled when the conversation was
+	// left. Follow means it was at the bottom, and should stay there as
+	// messages arrive.
+	Offset int
+	Follow bool
+	// Draft is what was typed but not sent.
+	Draft string
+	// Opened is set once the conversation has been on screen, which puts
+	// it in the rotation of Cycle.
+	Opened bool
+	// Unread arrived while the conversation was not open. They are read,
+	// and receipts sent, when it is opened.
+	Unread [] protocol.ChatMessage
+	// Active is when the latest message was sent.
+	Active time.Time
+	// Notified is when the user was last told about a message here.
+	Notified time.Time
+}
+
+func NewConversation(friend Friend, room string) * Conversation {
+
+	return &Conversation{
+		Friend: friend,
+		Room: room,
+		Typing: make(map[string] *TypeInfo),
+		Follow: true,
+	}
+}
+
+func RoomKey(room string) string {
+	return protocol.RoomConversation(room)
+}
+
+// Key names the conversation with friend, or in room if set, the same way
+// protocol.ChatMessage.Conversation does.
+func (m * Model) Key(friend Friend, room string) string {
+
+	if room != "" {
+		return RoomKey(room)
+	}
+
+	return protocol.Conversation(m.WhoAmI, string(friend))
+}
+
+// Conversation finds the conversation with friend or in room, starting it
+// if this is the first we have heard of it.
+func (m * Model) Conversation(friend Friend, room string) * Conversation {
+
+	key:= m.Key(friend, room)
+
+	conv, ok:= m.Conversations[key]
+
+	if !ok {
+
+		if room != "" {
+			friend = ""
+		}
+
+		conv = NewConversation(friend, room)
+		m.Conversations[key] = conv
+		m.Order = append(m.Order, key)
+	}
+
+	return conv
+}
+
+// ChatConversation is the conversation chat belongs to.
+func (m * Model) ChatConversation(chat protocol.ChatMessage) * Conversation {
+
+	friend:= chat.From
+
+	if friend == m.WhoAmI {
+		friend = chat.To
+	}
+
+	return m.Conversation(Friend(friend), chat.Room)
+}
+
+// Current is the conversation the chat view shows.
+func (m * Model) Current() * Conversation {
+	return m.Conversation(m.Friend, m.Room)
+}
+
+// Showing reports whether conv is on screen.
+func (m * Model) Showing(conv * Conversation) bool {
+	return m.CurrWindow == 3 && conv == m.Current()
+}
+
+// Reading reports whether the user can see the latest lines of the open
+// conversation: it has focus and is scrolled to the bottom.
+func (m * Model) Reading() bool {
+	return m.CurrWindow == 3 && m.Focus == FocusChat && m.ViewPort.AtBottom()
+}
+
+// DM is the conversation with friend, or nil if there has not been one.
+func (m * Model) DM(friend Friend) * Conversation {
+	return m.Conversations[m.Key(friend, "")]
+}
+
+func (m * Model) UnreadRoom(room string) int {
+
+	conv, ok:= m.Conversations[RoomKey(room)]
+
+	if !ok {
+		return 0
+	}
+
+	return len(conv.Unread)
+}
+
+// Leave remembers how the open conversation was left, and tells the
+// friend we are no longer typing there.
+func (m * Model) Leave() tea.Cmd {
+
+	if m.CurrWindow != 3 {
+		return nil
+	}
+
+	conv:= m.Current()
+
+	conv.Offset = m.ViewPort.YOffset
+	conv.Follow = m.ViewPort.AtBottom()
+	conv.Draft = m.TextArea.Value()
+
+	m.TypingCancelFunc()
+
+	if m.TypingSentAt.IsZero() {
+		return nil
+	}
+
+	m.TypingSentAt = time.Time{}
+
+	client, stopped:= m.Client, Typing(false, string(m.Friend), m.Room, m.Theme, m.WhoAmI)
+
+	return func() tea.Msg {
+
+		if err:= Send(client, stopped); err != nil {
+			log.Println(err)
+		}
+
+		return nil
+	}
+}
+
+// Back leaves the open conversation for the friend and room lists.
+func (m * Model) Back() tea.Cmd {
+
+	leave:= m.Leave()
+
+	m.CurrWindow = 2
+
+	return tea.Batch(leave, m.SetFocus(FocusFriends))
+}
+
+// Open shows the conversation with friend, or room if set, as it was
+// left, and marks what arrived meanwhile as read.
+func (m * Model) Open(friend Friend, room string) tea.Cmd {
+
+	leave:= m.Leave()
+
+	m.Friend = friend
+	m.Room = room
+	m.CurrWindow = 3
+	focus:= m.SetFocus(FocusChat)
+
+	conv:= m.Current()
+	conv.Opened = true
+
+	m.TextArea.Reset()
+	m.TextArea.SetValue(conv.Draft)
+
+	m.RenderMessages()
+
+	if conv.Follow {
+		m.ViewPort.GotoBottom()
+	}else{
+		m.ViewPort.SetYOffset(conv.Offset)
+	}
+
+	return tea.Batch(leave, focus, m.ReadVisible())
+}
+
+// OpenConversation shows conv.
+func (m * Model) OpenConversation(conv * Conversation) tea.Cmd {
+	return m.Open(conv.Friend, conv.Room)
+}
+
+// Cycle opens the next conversation that has been opened before, or the
+// previous one if step is -1, in the order they were started.
+func (m * Model) Cycle(step int) tea.Cmd {
+
+	return m.Next(step, func(conv * Conversation) bool {
+		return conv.Opened
+	})
+}
+
+// NextUnread opens the next conversation with unread messages.
+func (m * Model) NextUnread() tea.Cmd {
+
+	return m.Next(1, func(conv * Conversation) bool {
+		return len(conv.Unread) > 0
+	})
+}
+
+// Next walks Order from the open conversation, wrapping around, and opens
+// the first conversation that matches.
+func (m * Model) Next(step int, match func(* Conversation) bool) tea.Cmd {
+
+	if len(m.Order) == 0 {
+		return nil
+	}
+
+	start:= -1
+
+	if m.CurrWindow == 3 {
+		start = slices.Index(m.Order, m.Key(m.Friend, m.Room))
+	}
+
+	if start < 0 && step < 0 {
+		start = len(m.Order)
+	}
+
+	for i:= 1; i <= len(m.Order); i++ {
+
+		index:= ((start + step * i) % len(m.Order) + len(m.Order)) % len(m.Order)
+
+		conv:= m.Conversations[m.Order[index]]
+
+		if match(conv) && !m.Showing(conv) {
+			return m.OpenConversation(conv)
+		}
+	}
+
+	m.Notice = "Nothing else to open"
+
+	return nil
+}
+
+// Alert tells the user about chat, which arrived for conv while it was
+// not open. Replayed history is too old to be news, and a busy
+// conversation only alerts once every notifyEvery.
+func (m * Model) Alert(conv * Conversation, chat protocol.ChatMessage) tea.Cmd {
+
+	if time.Since(ChatLine(chat).Time) > notifyStale || time.Since(conv.Notified) < notifyEvery {
+		return nil
+	}
+
+	conv.Notified = time.Now()
+
+	return Notify(m.Notify, chat)
+}
+
+// Append adds a message, keeping track of when the conversation was last
+// active.
+func (c * Conversation) Append(line Line){
+
+	c.Messages = append(c.Messages, line)
+
+	if line.Time.After(c.Active) {
+		c.Active = line.Time
+	}
+}
+
+// Preview is the latest message, shortened for the friend list, or that
+// the friend is typing.
+func (c * Conversation) Preview() string {
+
+	if len(c.Typing) > 0 {
+		return "typing…"
+	}
+
+	for i:= len(c.Messages) - 1; i >= 0; i-- {
+
+		line:= c.Messages[i]
+
+		if line.Typing {
+			continue
+		}
+
+		text:= Clean(line.Text)
+
+		if line.Mine {
+			text = "You: " + text
+		}
+
+		return Shorten(text, previewLength)
+	}
+
+	return ""
+}
+
+// StartTyping shows an indicator for typing.From, unless one is up.
+func (c * Conversation) StartTyping(typing protocol.TypingMessage){
+
+	if _, ok:= c.Typing[typing.From]; ok {
+		return
+	}
+
+	c.Typing[typing.From] = &TypeInfo{
+		Index: len(c.Messages),
+		Color: typing.Color,
+		From: typing.From,
+	}
+
+	c.Messages = append(c.Messages, Line{
+		Time: time.Now(),
+		From: typing.From,
+		Room: typing.Room,
+		Color: typing.Color,
+		Typing: true,
+	})
+}
+
+// StopTyping takes down from's indicator.
+func (c * Conversation) StopTyping(from string){
+
+	typing, ok:= c.Typing[from]
+
+	if !ok {
+		return
+	}
+
+	c.Messages = slices.Delete(c.Messages, typing.Index, typing.Index+1)
+	delete(c.Typing, from)
+
+	//reset indexes
+
+	for _, otherTyping:= range c.Typing{
+		if otherTyping.Index >= typing.Index{
+			otherTyping.Index--
+		}
+	}
+}
+
+// ClearTyping drops the indicators, which may never be cleared after the
+// connection dropped.
+func (c * Conversation) ClearTyping(){
+
+	c.Messages = slices.DeleteFunc(c.Messages, func(line Line) bool {
+		return line.Typing
+	})
+
+	clear(c.Typing)
+}
+
+// Rendered reports whether chat is already in the conversation.
+func (c * Conversation) Rendered(chat protocol.ChatMessage) bool {
+
+	for _, line:= range c.Messages{
+
+		if line.Typing || line.From != chat.From {
+			continue
+		}
+
+		if (chat.ID != "" && line.ID == chat.ID) || (chat.ClientID != "" && line.ClientID == chat.ClientID) {
+			return true
+		}
+	}
+
+	return false
+}
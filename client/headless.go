@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Ikenna-Okpala/chatty"
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+// Headless is the client without the UI, for bots: every stdin line is
+// sent as a message and every message received is written to stdout as a
+// JSON line. Lines are sent one at a time, each waiting for its ack, so a
+// line the server throttles is retried instead of lost.
+type Headless struct {
+	Client * chatty.Client
+	User string
+	To string
+	Room string
+	Theme int
+	Out io.Writer
+	replies chan protocol.Message
+	closed chan error
+}
+
+// Recv forwards incoming frames until the connection closes. Chats go to
+// Out; answers to our own chats go to the sender.
+func (h * Headless) Recv(){
+
+	encoder:= json.NewEncoder(h.Out)
+
+	for event:= range h.Client.Events(){
+
+		switch event:= event.(type) {
+
+		case protocol.ChatMessage:
+			if err:= encoder.Encode(event); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+
+		case protocol.AckMessage, protocol.RateLimitedMessage:
+			h.replies <- event
+
+		case protocol.ErrorMessage:
+			if event.Type == protocol.TypeChat {
+				h.replies <- event
+			}else{
+				fmt.Fprintln(os.Stderr, event.Message)
+			}
+		}
+	}
+
+	h.closed <- closedError(h.Client)
+}
+
+// Deliver sends chat and waits until the server stores or rejects it.
+// Only losing the connection is an error; a rejected line is reported and
+// skipped.
+func (h * Headless) Deliver(chat protocol.ChatMessage) error {
+
+	for {
+
+		if err:= h.Client.Send(context.Background(), chat); err != nil {
+			return err
+		}
+
+		timeout:= time.NewTimer(sendTimeout)
+
+		retry, err:= h.await(chat, timeout.C)
+
+		timeout.Stop()
+
+		if err != nil || retry == 0 {
+			return err
+		}
+
+		time.Sleep(retry)
+	}
+}
+
+// await returns how long to wait before resending chat, or zero once the
+// server answered for good.
+func (h * Headless) await(chat protocol.ChatMessage, timeout <-chan time.Time) (time.Duration, error) {
+
+	for {
+
+		select {
+
+		case reply:= <- h.replies:
+
+			switch event:= reply.(type) {
+
+			case protocol.AckMessage:
+				if event.ClientID == chat.ClientID {
+					return 0, nil
+				}
+
+			case protocol.RateLimitedMessage:
+				if event.Type == protocol.TypeChat {
+					return time.Duration(event.RetryAfter) * time.Millisecond, nil
+				}
+
+			case protocol.ErrorMessage:
+				fmt.Fprintf(os.Stderr, "Not sent: %s\n", event.Message)
+				return 0, nil
+			}
+
+		case err:= <- h.closed:
+			return 0, err
+
+		case <- timeout:
+			return 0, errors.New("Timed out waiting for the server")
+		}
+	}
+}
+
+// closedError says why client's events ended.
+func closedError(client * chatty.Client) error {
+
+	err:= client.Err()
+
+	if reason, refused:= chatty.Refused(err); refused && reason != ""{
+		return errors.New(reason)
+	}
+
+	if err == nil {
+		return errors.New("Connection closed")
+	}
+
+	return err
+}
+
+// Run sends lines from in until it ends, then closes the connection.
+func (h * Headless) Run(in io.Reader) error {
+
+	go h.Recv()
+
+	if h.Room != "" {
+
+		if err:= h.Client.Send(context.Background(), protocol.RoomMessage{Action: "join", Name: h.Room}); err != nil {
+			return err
+		}
+	}
+
+	scanner:= bufio.NewScanner(in)
+
+	for scanner.Scan(){
+
+		text:= scanner.Text()
+
+		if strings.TrimSpace(text) == ""{
+			continue
+		}
+
+		if err:= h.Deliver(chatty.NewChat(h.User, h.To, h.Room, text, h.Theme)); err != nil {
+			return err
+		}
+	}
+
+	if err:= scanner.Err(); err != nil {
+		return err
+	}
+
+	return h.Client.Close()
+}
+
+func RunHeadless(options Options, in io.Reader, out io.Writer) error {
+
+	if (options.To == "") == (options.Room == ""){
+		return errors.New("Headless mode needs one of --to or --room")
+	}
+
+	client, err:= Open(options)
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	headless:= &Headless{
+		Client: client,
+		User: options.User,
+		To: options.To,
+		Room: options.Room,
+		Theme: options.Theme,
+		Out: out,
+		replies: make(chan protocol.Message, 16),
+		closed: make(chan error, 1),
+	}
+
+	return headless.Run(in)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+// Focus is the pane keys go to.
+type Focus int
+
+const (
+	FocusFriends Focus = iota
+	FocusRooms
+	FocusChat
+)
+
+const (
+	sidebarMin = 24
+	sidebarMax = 36
+	// Below narrowWidth only the focused pane is shown.
+	narrowWidth = 64
+)
+
+const (
+	sidebarHelp = "tab: pane • enter: open • ctrl+n: new room • ctrl+x: leave room • ctrl+o: unread • esc: quit"
+	chatHelp = "tab: pane • esc: back • ctrl+n/ctrl+p: next/previous chat • ctrl+o: unread"
+)
+
+var (
+	statusStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("252")).Background(lipgloss.Color("236"))
+	blurredBorder = lipgloss.Color("240")
+)
+
+func (m * Model) Narrow() bool {
+	return m.Width < narrowWidth
+}
+
+// SidebarWidth is how wide the friend and room lists are, or zero when
+// they are hidden behind the chat.
+func (m * Model) SidebarWidth() int {
+
+	if m.Narrow() {
+
+		if m.Focus == FocusChat {
+			return 0
+		}
+
+		return m.Width
+	}
+
+	return min(sidebarMax, max(sidebarMin, m.Width / 3))
+}
+
+// ChatWidth is what is left of the screen for the conversation.
+func (m * Model) ChatWidth() int {
+	return m.Width - m.SidebarWidth()
+}
+
+// Resize lays the panes out for a width by height screen.
+func (m * Model) Resize(width int, height int){
+
+	m.Width = width
+	m.Height = height
+
+	// The status bar takes the last line.
+	body:= max(0, height - 1)
+
+	sidebar:= max(0, m.SidebarWidth() - 2)
+	lists:= max(0, body - 2)
+
+	m.List.SetSize(sidebar, lists / 2)
+	m.Rooms.SetSize(sidebar, lists - lists / 2)
+
+	chat:= m.ChatWidth()
+
+	m.ViewPort.Width = chat
+	m.TextArea.SetWidth(chat)
+	m.ViewPort.Height = max(0, body - m.TextArea.Height() - 1)
+
+	m.RenderMessages()
+}
+
+// SetFocus moves keys to pane, colouring its title or border to show it.
+func (m * Model) SetFocus(pane Focus) tea.Cmd {
+
+	narrow:= m.Narrow() && (m.Focus == FocusChat) != (pane == FocusChat)
+
+	m.Focus = pane
+
+	focused:= titleStyle.Foreground(lipgloss.Color(strconv.Itoa(m.Theme)))
+
+	m.List.Styles.Title = titleStyle
+	m.Rooms.Styles.Title = titleStyle
+
+	switch pane {
+
+	case FocusFriends:
+		m.List.Styles.Title = focused
+
+	case FocusRooms:
+		m.Rooms.Styles.Title = focused
+	}
+
+	m.ThemeChat()
+
+	// Narrow screens swap the sidebar for the chat.
+	if narrow {
+		m.Resize(m.Width, m.Height)
+	}
+
+	if pane == FocusChat {
+		return m.TextArea.Focus()
+	}
+
+	m.TextArea.Blur()
+
+	return nil
+}
+
+// FocusNext is Tab: friends, rooms, then the open conversation.
+func (m * Model) FocusNext() tea.Cmd {
+
+	switch m.Focus {
+
+	case FocusFriends:
+		return m.SetFocus(FocusRooms)
+
+	case FocusRooms:
+
+		if m.CurrWindow == 3 {
+			return tea.Batch(m.SetFocus(FocusChat), m.ReadVisible())
+		}
+	}
+
+	return m.SetFocus(FocusFriends)
+}
+
+// SetTheme colours the UI in color.
+func (m * Model) SetTheme(color int){
+
+	m.Theme = color
+
+	m.Spinner.Style = lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(color)))
+
+	m.List.SetDelegate(FriendDelegate{
+		Theme: color,
+		Presence: m.Presence,
+		DM: m.DM,
+	})
+
+	m.Rooms.SetDelegate(RoomDelegate{
+		Theme: color,
+		Unread: m.UnreadRoom,
+	})
+
+	m.SetFocus(m.Focus)
+}
+
+// ThemeChat styles the conversation view in the user's colour, greyed out
+// when it does not have focus.
+func (m * Model) ThemeChat(){
+
+	border:= lipgloss.Color(strconv.Itoa(m.Theme))
+
+	if m.Focus != FocusChat {
+		border = blurredBorder
+	}
+
+	m.ViewPort.Style = lipgloss.NewStyle().
+		BorderStyle(lipgloss.RoundedBorder()).
+		BorderForeground(border).Padding(0, 1)
+
+	m.TextArea.Cursor.Style = lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(m.Theme)))
+
+	m.TextArea.Prompt = lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(m.Theme))).Render("┃")
+}
+
+func (m * Model) SidebarView() string {
+
+	width:= m.SidebarWidth()
+
+	if width == 0 {
+		return ""
+	}
+
+	friends:= m.List.View()
+
+	if len(m.List.Items()) <= 0 {
+		friends = lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(m.Theme))).Render(fmt.Sprintf("%s Waiting for users...", m.Spinner.View()))
+	}
+
+	border:= blurredBorder
+
+	if m.Focus != FocusChat {
+		border = lipgloss.Color(strconv.Itoa(m.Theme))
+	}
+
+	box:= lipgloss.NewStyle().
+		BorderStyle(lipgloss.RoundedBorder()).
+		BorderForeground(border).
+		Width(width - 2).
+		Height(max(0, m.Height - 3))
+
+	lists:= lipgloss.JoinVertical(lipgloss.Left,
+		lipgloss.NewStyle().Height(m.List.Height()).MaxHeight(m.List.Height()).Render(friends),
+		m.Rooms.View(),
+	)
+
+	return box.Render(lipgloss.NewStyle().MaxHeight(max(0, m.Height - 3)).Render(lists))
+}
+
+func (m * Model) ChatView() string {
+
+	width:= m.ChatWidth()
+
+	if width == 0 {
+		return ""
+	}
+
+	if m.CurrWindow != 3 {
+
+		box:= m.ViewPort.Style.
+			Width(width - m.ViewPort.Style.GetHorizontalBorderSize()).
+			Height(max(0, m.Height - 1 - m.ViewPort.Style.GetVerticalBorderSize()))
+
+		return box.Render(helpStyle.Render("Pick a friend or a room and press Enter to chat."))
+	}
+
+	if len(m.Current().Messages) == 0{
+
+		style:= lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(m.Theme)))
+
+		display:= fmt.Sprintf("Welcome to the %s's dm! Type a message and press Enter to send.", m.Friend)
+
+		if m.Room != "" {
+			display = fmt.Sprintf("Welcome to #%s! Type a message and press Enter to send.", m.Room)
+		}
+
+		m.ViewPort.SetContent(style.Width(max(0, width - m.ViewPort.Style.GetHorizontalFrameSize())).Render(display))
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left, m.ViewPort.View(), "", m.TextArea.View())
+}
+
+// StatusBar shows who we are, how the connection is doing, the last notice
+// and the keys for the focused pane.
+func (m * Model) StatusBar() string {
+
+	me:= lipgloss.NewStyle().
+		Background(lipgloss.Color(strconv.Itoa(m.Theme))).
+		Foreground(lipgloss.Color("0")).
+		Padding(0, 1).
+		Render(m.WhoAmI)
+
+	state:= protocol.StateOnline
+
+	if m.Away {
+		state = protocol.StateAway
+	}
+
+	badge, _:= PresenceBadge(protocol.PresenceMessage{State: state})
+
+	status:= statusStyle.Render(" ") + badge + statusStyle.Render(" " + state + " ")
+
+	if m.Reconnecting {
+		status = statusStyle.Foreground(lipgloss.Color("214")).Render(" " + m.Spinner.View() + " Reconnecting… ")
+	}
+
+	if m.Notice != "" {
+		status += statusStyle.Foreground(lipgloss.Color("196")).Render("! " + m.Notice + " ")
+	}
+
+	left:= me + status
+
+	help:= sidebarHelp
+
+	if m.Focus == FocusChat {
+		help = chatHelp
+	}
+
+	room:= max(0, m.Width - lipgloss.Width(left))
+
+	// Drop keys from the end until the rest fits.
+	keys:= strings.Split(help, " • ")
+
+	for len(keys) > 0 && lipgloss.Width(strings.Join(keys, " • ") + " ") > room {
+		keys = keys[:len(keys) - 1]
+	}
+
+	help = strings.Join(keys, " • ")
+
+	return left + statusStyle.Width(room).MaxWidth(room).Align(lipgloss.Right).Render(help + " ")
+}
+
+// SplitView is the sidebar next to the open conversation, over the status
+// bar.
+func (m * Model) SplitView() string {
+
+	body:= lipgloss.JoinHorizontal(lipgloss.Top, m.SidebarView(), m.ChatView())
+
+	return lipgloss.JoinVertical(lipgloss.Left, body, m.StatusBar())
+}
@@ -2,18 +2,15 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
-	"math/rand/v2"
-	"net/url"
 	"os"
 	"slices"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/charmbracelet/bubbles/list"
@@ -23,7 +20,8 @@ import (
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/gorilla/websocket"
+	"github.com/Ikenna-Okpala/chatty"
+	"github.com/Ikenna-Okpala/chatty/protocol"
 )
 
 const (
@@ -37,6 +35,7 @@ var (
 	paginationStyle = list.DefaultStyles().PaginationStyle.PaddingLeft(4)
 	helpStyle = list.DefaultStyles().HelpStyle.PaddingLeft(4).PaddingBottom(1)
 	quitStyle = lipgloss.NewStyle().Margin(1, 0, 2, 4)
+	warningStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("214")).PaddingLeft(2)
 )
 
 
@@ -46,9 +45,14 @@ func (f Friend) FilterValue() string {return ""}
 
 type FriendDelegate struct{
 	Theme int
+	Presence map[string] protocol.PresenceMessage
+	DM func(Friend) * Conversation
 }
 
-func (f FriendDelegate) Height() int{return 1}
+var previewStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("245")).PaddingLeft(7)
+
+// Height fits the friend's name, then their last message.
+func (f FriendDelegate) Height() int{return 2}
 
 func (f FriendDelegate) Spacing() int {return 0}
 
@@ -62,7 +66,35 @@ func (f FriendDelegate) Render(w io.Writer, m list.Model, index int, listFriend
 		return
 	}
 
-	str:= fmt.Sprintf("%d. %s", index + 1, friend)
+	presence, ok:= f.Presence[string(friend)]
+
+	if !ok {
+		presence = protocol.PresenceMessage{User: string(friend), State: protocol.StateOnline}
+	}
+
+	badge, lastSeen:= PresenceBadge(presence)
+
+	unread:= ""
+	preview:= strings.TrimPrefix(lastSeen, " · ")
+
+	if conv:= f.DM(friend); conv != nil {
+
+		if n:= len(conv.Unread); n > 0 {
+			unread = " " + lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(strconv.Itoa(f.Theme))).Render(fmt.Sprintf("(%d)", n))
+		}
+
+		if last:= conv.Preview(); last != "" {
+			preview = last
+		}
+	}
+
+	name:= string(friend)
+
+	if presence.Color != 0 && m.Index() != index {
+		name = lipgloss.NewStyle().Foreground(Foreground(presence.Color)).Render(name)
+	}
+
+	str:= fmt.Sprintf("%d. %s %s%s", index + 1, badge, name, unread)
 
 	fn:= itemStyle.Render
 
@@ -74,7 +106,11 @@ func (f FriendDelegate) Render(w io.Writer, m list.Model, index int, listFriend
 		}
 	}
 
-	fmt.Fprint(w, fn(str))
+	line:= lipgloss.NewStyle().MaxWidth(m.Width())
+
+	preview = Shorten(preview, max(1, m.Width() - previewStyle.GetPaddingLeft()))
+
+	fmt.Fprint(w, line.Render(fn(str)) + "\n" + line.Render(previewStyle.Render(preview)))
 }
 
 type TypeInfo struct{
@@ -86,22 +122,53 @@ type TypeInfo struct{
 type Model struct {
 	List list.Model
 	Friend Friend
+	Rooms list.Model
+	Room string
+	Focus Focus
+	Width int
+	Height int
+	RoomInput textinput.Model
 	ExitMessage string
 	Input textinput.Model
+	Password textinput.Model
 	WhoAmI string
-	Conn * websocket.Conn
+	Token string
+	Client * chatty.Client
 	Spinner spinner.Model
 	CurrWindow int
 	ViewPort viewport.Model
 	TextArea textarea.Model
-	Messages [] string
-	RecvChan chan MessageRecvMsg
+	Conversations map[string] *Conversation
+	// Order is the conversations' keys, in the order they started.
+	Order [] string
+	Pending [] protocol.ChatMessage
+	// Held are the client ids of pending chats the server throttled. They
+	// go out again oldest first, one at a time, once it allows.
+	Held map[string] bool
+	// Retrying is set while we wait out a rate limit on held chats.
+	Retrying bool
 	Theme int
 	TypingCtx context.Context
 	TypingCancelFunc context.CancelFunc
+	TypingSentAt time.Time
 	PointsSpinner spinner.Model
-	EventTracking map[string] *TypeInfo
-	connMutex sync.Mutex
+	Active [] Friend
+	Presence map[string] protocol.PresenceMessage
+	LastActivity time.Time
+	Away bool
+	Notice string
+	OpenDM Friend
+	Reconnecting bool
+	Attempt int
+	// Resume is the window to go back to after logging in again.
+	Resume int
+	// Notify is how to tell the user about messages for other chats.
+	Notify string
+	// ChosenTheme is the colour asked for with -theme, saved to our
+	// profile when we log in.
+	ChosenTheme int
+	// Register creates the account rather than logging into it.
+	Register bool
 }
 
 type ErrorMsg struct{err error}
@@ -112,26 +179,7 @@ func (e ErrorMsg) Error() string{
 	return e.err.Error()
 }
 
-func InitColor() int {
-
-	blacklist:= [] int{
-		8,
-		15,
-		16,
-	}
-
-
-	color:= rand.IntN(229) + 1
-
-	for slices.Contains(blacklist, color) {
-		color = rand.IntN(229) + 1
-	}
-
-
-	return color
-}
-
-func InitialModel() * Model {
+func InitialModel(options Options) * Model {
 
 	ta:= textarea.New()
 
@@ -159,13 +207,17 @@ func InitialModel() * Model {
 
 	const defaultWidth = 20
 
-	color:= InitColor()
+	color:= defaultTheme
 
-	l:= list.New([]list.Item{}, FriendDelegate{
-		Theme: color,
-	}, defaultWidth, listHeight)
+	if options.Theme != 0 {
+		color = Readable(options.Theme)
+	}
+
+	presence:= make(map[string] protocol.PresenceMessage)
+
+	l:= list.New([]list.Item{}, FriendDelegate{}, defaultWidth, listHeight)
 
-	l.Title = "Who do you want to chat with?"
+	l.Title = "Friends"
 
 	l.SetShowStatusBar(false)
 
@@ -177,6 +229,31 @@ func InitialModel() * Model {
 
 	l.Styles.HelpStyle = helpStyle
 
+	l.SetShowHelp(false)
+
+	rooms:= list.New([]list.Item{}, RoomDelegate{}, defaultWidth, listHeight)
+
+	rooms.Title = "Rooms"
+
+	rooms.SetShowStatusBar(false)
+
+	rooms.SetFilteringEnabled(false)
+
+	rooms.SetShowHelp(false)
+
+	rooms.Styles.Title = titleStyle
+
+	rooms.Styles.PaginationStyle = paginationStyle
+
+	rooms.Styles.NoItems = itemStyle
+
+	ri:= textinput.New()
+
+	ri.Placeholder = "Room name:"
+
+	ri.CharLimit = 32
+
+	ri.Width = 20
 
 	ti:= textinput.New()
 
@@ -188,6 +265,18 @@ func InitialModel() * Model {
 
 	ti.Width = 20
 
+	pi:= textinput.New()
+
+	pi.Placeholder = "Password:"
+
+	pi.EchoMode = textinput.EchoPassword
+
+	pi.EchoCharacter = '•'
+
+	pi.CharLimit = 72
+
+	pi.Width = 20
+
 	s:= spinner.New()
 
 	ellipsis:= spinner.New()
@@ -202,54 +291,70 @@ func InitialModel() * Model {
 
 	typingCtx, typingCancelFuc:= context.WithCancel(context.Background())
 
-	return &Model{
+	window:= 0
+
+	// Skip the prompts we already have answers for.
+	if options.User != "" {
+		ti.SetValue(options.User)
+		ti.Blur()
+		pi.Focus()
+		window = 5
+
+		if options.Password != "" {
+			pi.SetValue(options.Password)
+			pi.Blur()
+			window = 1
+		}
+	}
+
+	m:= &Model{
 		Input: ti,
+		Password: pi,
 		Spinner: s,
 		List: l,
+		Rooms: rooms,
+		RoomInput: ri,
 		TextArea: ta,
 		ViewPort: vp,
-		RecvChan: make(chan MessageRecvMsg),
 		Theme: color,
 		TypingCtx: typingCtx,
 		TypingCancelFunc: typingCancelFuc,
 		PointsSpinner: ellipsis,
-		EventTracking: make(map[string]*TypeInfo),
+		Conversations: make(map[string] *Conversation),
+		Held: make(map[string] bool),
+		Presence: presence,
+		LastActivity: time.Now(),
+		WhoAmI: options.User,
+		CurrWindow: window,
+		OpenDM: Friend(options.To),
+		Notify: options.Notify,
+		ChosenTheme: options.Theme,
+		Register: options.Register,
 
 	}
+
+	m.SetTheme(color)
+
+	return m
 }
 
 type ConnMsg struct{
-	Conn *websocket.Conn
+	Client * chatty.Client
 }
 
-var HOST = ""
-
-
-func Connect(whoAmI string) tea.Cmd {
+func Connect(whoAmI string, token string) tea.Cmd {
 
 		return func() tea.Msg {
 
-			if HOST == ""{
-				return ErrorMsg{err: errors.New("Env Failure")}
-			}
-
-			url:= url.URL{
-				Scheme: "wss",
-				Host: HOST,
-				Path: "/chat/"+whoAmI,
-			}
-		
-			c, _, err:= websocket.DefaultDialer.Dial(url.String(), nil)
+			client, err:= chatty.Dial(context.Background(), server, whoAmI, token)
 
-		
 			if err != nil {
 				log.Println(err)
-				return ErrorMsg{err: err}
+				fatal, _:= Fatal(err)
+				return ErrorMsg{err: fatal}
 			}
 
-			//log.Println("Returning connection...")
-		
-			return ConnMsg{Conn: c}
+			return ConnMsg{Client: client}
 		
 		}
 }
@@ -257,219 +362,108 @@ func Connect(whoAmI string) tea.Cmd {
 
 func (m * Model) Init () tea.Cmd {
 
+	var login tea.Cmd
+
+	if m.CurrWindow == 1 {
+		login = m.SubmitPassword(m.Register)
+	}
+
 	return tea.Batch(
+		login,
 		textinput.Blink,
 		m.Spinner.Tick,
 		textarea.Blink,
 		m.PointsSpinner.Tick,
+		IdleCheck(),
 	)
 }
 
 type DoneMsg struct{}
 
-func FinalWords(conn * websocket.Conn) tea.Cmd{
+func FinalWords(client * chatty.Client) tea.Cmd{
 
+	return func() tea.Msg {
 
-	if conn != nil {
-		err:= conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-
-		if err != nil {
-			//log.Println(err)
+		if client != nil {
+			if err:= client.Close(); err != nil {
+				log.Println(err)
+			}
 		}
-	}
-	
-	return func() tea.Msg {
-		time.Sleep(time.Second * 1)
+
 		return DoneMsg{}
 	}
-
-	
-}
-
-type Message interface {
-	Recv()
-}
-
-type MessageWrapper struct{
-	Type string `json:"type"`
-	Value json.RawMessage `json:"value"`
-}
-
-
-type ChatMessage struct {
-	To string `json:"to"`
-	From string `json:"from"`
-	Text string `json:"text"`
-	Color int `json:"color"`
 }
 
-type TypingMessage struct {
-	IsTyping bool `json:"isTyping"`
-	To string `json:"to"`
-	Color int `json:"color"`
-	From string `json:"from"`
+type MessageSentMsg struct{
+	Chat protocol.ChatMessage
 }
 
-func (cm ChatMessage) Recv(){}
-
-
-type FriendList [] Friend
-func (friendList FriendList) Recv(){}
-
-
-func (t TypingMessage) Recv(){}
-
-type MessageSentMsg struct{}
-
 type MessageRecvMsg struct{
-	message Message
+	message protocol.Message
 }
 
-func SyncSend(mux * sync.Mutex, conn *websocket.Conn, messageWrapper MessageWrapper) error{
-	mux.Lock()
-
-	defer mux.Unlock()
+// Send writes msg, treating a connection we do not have yet as offline.
+func Send(client * chatty.Client, msg protocol.Message) error {
 
-	if err:= conn.WriteJSON(messageWrapper); err != nil {
-		return err
+	if client == nil {
+		return ErrOffline
 	}
 
-	return nil
-
+	return client.Send(context.Background(), msg)
 }
 
-func SendText(conn *websocket.Conn, mux * sync.Mutex, whoAmI string, friend Friend, text string, color int) tea.Cmd {
-
-	message:= ChatMessage{
-		To: string(friend),
-		From:whoAmI,
-		Text: text,
-		Color: color,
-	}
+func SendText(client * chatty.Client, message protocol.ChatMessage) tea.Cmd {
 
 	return func() tea.Msg {
 
-	raw, err:= json.Marshal(message)
-
-	if err != nil {
-		return ErrorMsg{err:err}
-	}
-
-	messageWrapper:= MessageWrapper{
-		Type: "chat",
-		Value: raw,
+	if err:= Send(client, message); err != nil {
+		return DisconnectedMsg{Client: client, err: err}
 	}
 
-	
+	if err:= Send(client, Typing(false, message.To, message.Room, message.Color, message.From)); err != nil {
 
-	if err:= SyncSend(mux, conn, messageWrapper); err != nil {
-		return ErrorMsg{err:err}
+		log.Println(err)
 	}
 
-	typingWrapper:= JsonTyping(false, string(friend), color, whoAmI)
-
 
-	if err:= SyncSend(mux, conn, typingWrapper); err != nil {
-
-		//log.Println(err)
-	}
-
-
-	//log.Printf("Sent message to friend:%s\n", friend)
-
-	return MessageSentMsg{}
-
-	}
-}
-
-func ShortLiveRecv (recvChan chan MessageRecvMsg) tea.Cmd{
-
-	return func() tea.Msg {
+	log.Println("Sent", message.ClientID, "to", message.To, message.Room)
 
-		msg:= <- recvChan
+	return MessageSentMsg{Chat: message}
 
-		return msg
 	}
 }
 
-func RecvMessage (conn  * websocket.Conn, recvChan chan MessageRecvMsg) tea.Cmd {
+// RecvMessage waits for the next event from the server. When the
+// connection ends it reports why: nothing for a normal close, an error for
+// a session the server will not take back, otherwise a reconnect.
+func RecvMessage(client * chatty.Client) tea.Cmd {
 
 	return func() tea.Msg {
 
-		for{
-			msg:= new(MessageWrapper)
+		event, ok:= <- client.Events()
 
-			_, incoming, err:= conn.ReadMessage()
-
-			if err != nil {
-
-				if websocket.IsCloseError(err, websocket.CloseNormalClosure){
-					return nil
-				}else{
-					//log.Println(err)
-					return ErrorMsg{err: err}
-				}
-				
-			}
-
-			//log.Println("Received text: ", string(incoming))
-
-			if err:= json.Unmarshal(incoming, msg); err!= nil {
-				return ErrorMsg{err: err}
-			}
-
-			chatMessage:= new(ChatMessage)
-			typingStatus:= new(TypingMessage)
-			friendsMesage:= new(FriendList)
-
-			var message Message
-
-			go func(){
-
-				// log.Println("Processing received message")
-
-				switch msg.Type {
-				case "chat":
-					err:= json.Unmarshal(msg.Value, chatMessage)
-
-					if err != nil {
-						fmt.Println(err)
-					}
-					message = *chatMessage
-
-				case "typing":
-					err:= json.Unmarshal(msg.Value, typingStatus)
-
-					if err != nil {
-						fmt.Println(err)
-					}
-					message = *typingStatus
-
-				case "friends":
-					err:= json.Unmarshal(msg.Value, friendsMesage)
-
-					if err != nil {
-						fmt.Println(err)
-					}
+		if ok {
+			return MessageRecvMsg{message: event}
+		}
 
-					message = *friendsMesage
+		err:= client.Err()
 
-				}
-				recvChan <-  MessageRecvMsg{
-					message: message,
-				}
-			}()
+		if err == nil {
+			return nil
 		}
 
+		if fatal, ok:= Fatal(err); ok {
+			return ErrorMsg{err: fatal}
+		}
 
+		log.Println(err)
+		return DisconnectedMsg{Client: client, err: err}
 	}
 }
 
 func TimeStamp() string{
 
-	time:= time.Now()
-
-	return fmt.Sprintf("[%d:%d]", time.Hour(), time.Minute())
+	return FormatTime(time.Now())
 
 }
 
@@ -482,37 +476,32 @@ func FriendsToItems(friends [] Friend) [] list.Item {
 	return items
 }
 
-func JsonTyping(isTyping bool, to string, color int, from string) MessageWrapper{
-	typingMessage:= TypingMessage{
+func Typing(isTyping bool, to string, room string, color int, from string) protocol.TypingMessage {
+
+	return protocol.TypingMessage{
 		IsTyping: isTyping,
 		To: to,
+		Room: room,
 		Color: color,
 		From: from,
 	}
-
-	raw, err:= json.Marshal(typingMessage)
-
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	return MessageWrapper{
-		Type: "typing",
-		Value: raw,
-	}
-
 }
 
-func TypingObserver(ctx context.Context, conn * websocket.Conn, mux * sync.Mutex, to string, color int, from string) tea.Cmd {
+// typingAnnounceEvery spaces out "is typing" events so a fast typist stays
+// well under the server's typing rate limit.
+const typingAnnounceEvery = time.Second * 2
+
+func TypingObserver(ctx context.Context, client * chatty.Client, to string, room string, color int, from string, announce bool) tea.Cmd {
 
 	return func() tea.Msg {
 
-		//log.Println("Sending type info...")
+		if announce {
 
-		typingWrapper:= JsonTyping(true, to, color, from)
+			log.Println("Sending typing to", to, room)
 
-		if err:= SyncSend(mux, conn, typingWrapper); err != nil {
-			//log.Println(err)
+			if err:= Send(client, Typing(true, to, room, color, from)); err != nil {
+				log.Println(err)
+			}
 		}
 		
 
@@ -520,16 +509,15 @@ func TypingObserver(ctx context.Context, conn * websocket.Conn, mux * sync.Mutex
 		select {
 
 		case <- delay.C:
-			//log.Println("Terminating typing...")
+			log.Println("Typing stopped")
 
-			typingWrapper:= JsonTyping(false, to, color, from)
-			if err:= SyncSend(mux, conn, typingWrapper); err != nil {
+			if err:= Send(client, Typing(false, to, room, color, from)); err != nil {
 
-				//log.Println(err)
+				log.Println(err)
 			}
 		case <- ctx.Done():
 
-			//log.Println("Terminating context...")
+			log.Println("Typing cancelled")
 			return nil
 		}
 
@@ -554,22 +542,51 @@ func (m * Model) Update(msg tea.Msg) (tea.Model, tea.Cmd){
 	switch msgT:= msg.(type) {
 
 	case tea.WindowSizeMsg:
-		m.List.SetWidth(msgT.Width)
-		m.ViewPort.Width = msgT.Width
-		m.TextArea.SetWidth(msgT.Width)
+		m.Resize(msgT.Width, msgT.Height)
+		return m, nil
+
+	case tea.KeyMsg:
+
+		m.LastActivity = time.Now()
+		m.Notice = ""
 
-		m.ViewPort.Height = msgT.Height - m.TextArea.Height() - lipgloss.Height(gap)
+		var presenceCmd tea.Cmd
 
-		if len(m.Messages) > 0{
-			m.ViewPort.SetContent(lipgloss.NewStyle().Width(m.ViewPort.Width).Render(strings.Join(m.Messages, gap)))
+		if m.Away && m.Client != nil {
+			m.Away = false
+			presenceCmd = SendPresence(m.Client, protocol.StateOnline)
 		}
 
-		m.ViewPort.GotoBottom()
-		return m, nil
+		if presenceCmd != nil {
+			model, cmd:= m.Update(msg)
+			return model, tea.Batch(presenceCmd, cmd)
+		}
 
-	case tea.KeyMsg:
+		if m.Split() && msgT.Type == tea.KeyTab {
+			return m, m.FocusNext()
+		}
+
+		chatting:= m.CurrWindow == 3 && m.Focus == FocusChat
+
+		if chatting {
+
+			switch msgT.Type {
+
+			case tea.KeyEsc:
+				return m, m.Back()
+
+			case tea.KeyCtrlN:
+				return m, m.Cycle(1)
+
+			case tea.KeyCtrlP:
+				return m, m.Cycle(-1)
+
+			case tea.KeyCtrlO:
+				return m, m.NextUnread()
+			}
+		}
 
-		if m.CurrWindow == 3 && !slices.Contains(BlackListTypingKeys(), msgT.Type){
+		if chatting && !slices.Contains(BlackListTypingKeys(), msgT.Type){
 			m.TypingCancelFunc()
 
 			var(
@@ -586,63 +603,147 @@ func (m * Model) Update(msg tea.Msg) (tea.Model, tea.Cmd){
 			m.TypingCancelFunc = cancel
 			
 			
-			return m, tea.Batch(TypingObserver(m.TypingCtx, m.Conn, &m.connMutex, string(m.Friend), m.Theme, m.WhoAmI,), tiCmd, vpCmd)
+			announce:= time.Since(m.TypingSentAt) > typingAnnounceEvery
+
+			if announce {
+				m.TypingSentAt = time.Now()
+			}
+			
+			return m, tea.Batch(TypingObserver(m.TypingCtx, m.Client, string(m.Friend), m.Room, m.Theme, m.WhoAmI, announce), tiCmd, vpCmd, m.ReadVisible())
+
+
+		}
+
+		if m.CurrWindow == 4 {
+
+			switch msgT.Type {
+
+			case tea.KeyEsc:
+				m.CurrWindow = 2
+				return m, nil
+
+			case tea.KeyEnter:
+				name:= strings.TrimSpace(m.RoomInput.Value())
+
+				if name == "" {
+					return m, nil
+				}
+
+				m.RoomInput.Reset()
+				m.RoomInput.Blur()
+				m.CurrWindow = 2
+
+				return m, SendRoom(m.Client, "create", name)
+			}
 
+			var riCmd tea.Cmd
+			m.RoomInput, riCmd = m.RoomInput.Update(msg)
 
+			return m, riCmd
+		}
+
+		if m.Split() && !chatting {
+
+			switch msgT.Type {
+
+			case tea.KeyCtrlN:
+				back:= m.Back()
+				m.CurrWindow = 4
+				return m, tea.Batch(back, m.RoomInput.Focus())
+
+			case tea.KeyCtrlO:
+				return m, m.NextUnread()
+
+			case tea.KeyCtrlX:
+				room, ok:= m.Rooms.SelectedItem().(Room)
+
+				if m.Focus == FocusRooms && ok && room.Joined {
+					return m, SendRoom(m.Client, "leave", room.Name)
+				}
+
+				return m, nil
+			}
 		}
 
 		switch msgT.Type {
 
 		case tea.KeyCtrlC, tea.KeyEsc:
 			m.ExitMessage = lipgloss.NewStyle().Foreground(lipgloss.Color("46")).Render("Goodbye!!!")
-			return m, FinalWords(m.Conn)
+			return m, FinalWords(m.Client)
 
-		
-		case tea.KeyUp, tea.KeyPgUp:
-			m.ViewPort.ScrollUp(1)
+		case tea.KeyCtrlR:
+
+			if m.CurrWindow == 5 {
+				return m, m.SubmitPassword(true)
+			}
 
 		
-		case tea.KeyDown, tea.KeyPgDown:
-			m.ViewPort.ScrollDown(1)
 
 		case tea.KeyEnter:
 
 			if m.CurrWindow == 0{
 				m.WhoAmI = m.Input.Value()
-				m.CurrWindow = 1
-				return m, Connect(m.WhoAmI)
-			} else if m.CurrWindow == 2{
+				m.CurrWindow = 5
+				m.Input.Blur()
+				return m, m.Password.Focus()
+			} else if m.CurrWindow == 5{
+				return m, m.SubmitPassword(m.Register)
+			} else if m.Split() && m.Focus == FocusRooms {
 
-				friend, ok:= m.List.SelectedItem().(Friend)
+				room, ok:= m.Rooms.SelectedItem().(Room)
 
-				//log.Println("Selected Friend: ", friend)
+				if !ok {
+					return m, nil
+				}
 
-				if ok {
-					m.Friend = friend
-					m.CurrWindow = 3
-					m.TextArea.Reset()
+				open:= m.Open("", room.Name)
+
+				if !room.Joined {
+					return m, tea.Batch(SendRoom(m.Client, "join", room.Name), open)
+				}
 
+				return m, open
+			} else if m.Split() && m.Focus == FocusFriends {
 
-					
-						m.ViewPort.Style = lipgloss.NewStyle().
-						BorderStyle(lipgloss.RoundedBorder()).
-						BorderForeground(lipgloss.
-							Color(strconv.Itoa(m.Theme))).Padding(2)
-					
-						m.TextArea.Cursor.Style = lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(m.Theme)))
+				friend, ok:= m.List.SelectedItem().(Friend)
 
-						m.TextArea.Prompt = lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(m.Theme))).Render("┃")
+				log.Println("Selected friend:", friend)
 
-				}else{
-					//log.Println("Cannot select friend")
+				if !ok {
+					log.Println("Cannot select friend")
+					return m, nil
 				}
 
-				return m, nil
-			} else if m.CurrWindow == 3 {
+				return m, m.Open(friend, "")
+			} else if chatting {
 
 				if m.TextArea.Value() > ""{
 
-					return m, SendText(m.Conn, &m.connMutex, m.WhoAmI, m.Friend, m.TextArea.Value(), m.Theme)
+					chat:= chatty.NewChat(m.WhoAmI, string(m.Friend), m.Room, m.TextArea.Value(), m.Theme)
+
+					line:= ChatLine(chat)
+					line.Mine = true
+					line.State = StateSending
+
+					conv:= m.Current()
+					conv.Append(line)
+					m.SyncFriends()
+					m.Pending = append(m.Pending, chat)
+					m.TextArea.Reset()
+					m.RenderMessages()
+
+					// Queued until we are back; Resend flushes it.
+					if m.Reconnecting {
+						return m, nil
+					}
+
+					// Behind throttled chats, so it waits its turn.
+					if len(m.Held) > 0 {
+						m.Held[chat.ClientID] = true
+						return m, nil
+					}
+
+					return m, SendText(m.Client, chat)
 
 				}
 				
@@ -659,109 +760,290 @@ func (m * Model) Update(msg tea.Msg) (tea.Model, tea.Cmd){
 		m.Spinner, cmd1 = m.Spinner.Update(msgT)
 		m.PointsSpinner, cmd2 = m.PointsSpinner.Update(msgT)
 
-		for _, typing:= range m.EventTracking{
-
-			receiverStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(typing.Color)))
-			m.Messages[typing.Index] = receiverStyle.Render(fmt.Sprintf("%s %s: %s", TimeStamp(), typing.From, m.PointsSpinner.View()))
+		if m.CurrWindow == 3 && len(m.Current().Typing) > 0 {
+			m.RenderMessages()
 		}
 
-		m.ViewPort.SetContent(lipgloss.NewStyle().Width(m.ViewPort.Width).Render(strings.Join(m.Messages, gap)))
-		m.ViewPort.GotoBottom()
-
 		return m, tea.Batch(cmd1, cmd2)
 
 	
 	case ErrorMsg:
 		m.ExitMessage = lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Render(msgT.Error())
-		//log.Println(m.ExitMessage)
-		return m, FinalWords(m.Conn)
+		log.Println(msgT.Error())
+		return m, FinalWords(m.Client)
 
 	case DoneMsg:
 		return m, tea.Quit
 		
 	
+	case IdleCheckMsg:
+
+		if m.Client != nil && !m.Away && time.Since(m.LastActivity) > idleAfter {
+			m.Away = true
+			return m, tea.Batch(SendPresence(m.Client, protocol.StateAway), IdleCheck())
+		}
+
+		return m, IdleCheck()
+
+	case AuthFailedMsg:
+		m.CurrWindow = 5
+		m.Notice = msgT.Reason
+		return m, m.Password.Focus()
+
+	case AuthMsg:
+		m.Token = msgT.Token
+
+		if msgT.Color != 0 {
+			m.SetTheme(Readable(msgT.Color))
+		}
+
+		// Logged in again after the token expired.
+		if m.Reconnecting {
+			m.CurrWindow = m.Resume
+			return m, tea.Batch(m.SetFocus(m.Focus), Reconnect(m.WhoAmI, m.Token, 0))
+		}
+
+		return m, Connect(m.WhoAmI, m.Token)
+
 	case ConnMsg:
 		m.CurrWindow = 2
-		m.Conn = msgT.Conn
+		m.Client = msgT.Client
+		m.SetFocus(FocusFriends)
+
+		if m.OpenDM != "" {
+			return m, tea.Batch(m.Open(m.OpenDM, ""), RecvMessage(m.Client))
+		}
+
 		return m, tea.Batch(
-		tea.Batch(RecvMessage(m.Conn, m.RecvChan),
-		ShortLiveRecv(m.RecvChan),
-		))
+		RecvMessage(m.Client),
+		)
 	
 	
 	case MessageSentMsg:
+		return m, nil
 
-		senderStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(m.Theme)))
+	case RetryMsg:
+		m.Retrying = false
+		return m, m.ResendHeld()
 
-		m.Messages = append(m.Messages, senderStyle.Render(fmt.Sprintf("%s You: %s", TimeStamp(), m.TextArea.Value())))
-		m.ViewPort.SetContent(lipgloss.NewStyle().Width(m.ViewPort.Width).Render(strings.Join(m.Messages, gap)))
-		m.TextArea.Reset()
-		m.ViewPort.GotoBottom()
+	case DisconnectedMsg:
 
-		return m, nil
+		if m.Reconnecting || msgT.Client == nil || msgT.Client != m.Client {
+			return m, nil
+		}
+
+		if m.Client != nil {
+			m.Client.Close()
+		}
+
+		m.Client = nil
+		m.Reconnecting = true
+		m.Attempt = 0
+
+		return m, Reconnect(m.WhoAmI, m.Token, Backoff(m.Attempt))
+
+	case ReconnectFailedMsg:
+		m.Attempt++
+		return m, Reconnect(m.WhoAmI, m.Token, Backoff(m.Attempt))
+
+	case ExpiredMsg:
+		// Conversations and pending chats stay; logging in reconnects.
+		m.Resume = m.CurrWindow
+		m.CurrWindow = 5
+		m.Notice = "Your session expired, enter your password to reconnect"
+		return m, m.Password.Focus()
+
+	case ReconnectedMsg:
+		m.Client = msgT.Client
+		m.Reconnecting = false
+		m.Attempt = 0
+		m.ClearTyping()
+
+		// Resend sends everything pending, held or not.
+		clear(m.Held)
+
+		cmds:= [] tea.Cmd{RecvMessage(m.Client), m.Resend()}
+
+		if m.Away {
+			cmds = append(cmds, SendPresence(m.Client, protocol.StateAway))
+		}
+
+		return m, tea.Batch(cmds...)
 
 	
 	case MessageRecvMsg:
 
-		//log.Println("Just received msg....")
+		log.Printf("Received %T\n", msgT.message)
 
 		switch event:= msgT.message.(type){
 
-		case ChatMessage:
-			receiverStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(event.Color)))
+		case protocol.ChatMessage:
 
+			conv:= m.ChatConversation(event)
+
+			// A replay after a reconnect can repeat what we already show.
+			if conv.Rendered(event) {
+				return m, RecvMessage(m.Client)
+			}
+
+			// Sent from another of our devices.
+			mine:= event.From == m.WhoAmI
+
+			line:= ChatLine(event)
+			line.Mine = mine
+
+			if mine {
+				line.Color = m.Theme
+				line.State = ReceiptSent
+			}
 			
-			m.Messages = append(m.Messages,
-				receiverStyle.Render(
-					fmt.Sprintf("%s %s: %s", TimeStamp(), event.From, event.Text),
-					))
-			m.ViewPort.SetContent(lipgloss.NewStyle().Width(m.ViewPort.Width).Render(strings.Join(m.Messages, gap)))
-			m.ViewPort.GotoBottom()
-	
-			return m, ShortLiveRecv(m.RecvChan)
-		
-		case FriendList:
-			m.List.SetItems(FriendsToItems(event))
-			return m, ShortLiveRecv(m.RecvChan)
+			conv.Append(line)
 
-		
-		case TypingMessage:
-			if event.IsTyping{
+			if event.Room == "" {
+				m.SyncFriends()
+			}
+
+			if mine {
+				m.RenderMessages()
+				return m, RecvMessage(m.Client)
+			}
+
+			// Messages for another conversation wait there, counted as unread.
+			if !m.Showing(conv) {
+				conv.Unread = append(conv.Unread, event)
+				return m, tea.Batch(m.Alert(conv, event), RecvMessage(m.Client))
+			}
+
+			m.RenderMessages()
+
+			if event.ID == "" {
+				return m, RecvMessage(m.Client)
+			}
+
+			// Read once it is actually in view.
+			conv.Unread = append(conv.Unread, event)
+
+			return m, tea.Batch(m.ReadVisible(), RecvMessage(m.Client))
+
+		case protocol.AckMessage:
+
+			m.Pending = slices.DeleteFunc(m.Pending, func(chat protocol.ChatMessage) bool {
+				return chat.ClientID == event.ClientID
+			})
 
-				if _, ok:= m.EventTracking[event.From]; !ok {
-					m.EventTracking[event.From] = &TypeInfo{
-						Index: len(m.Messages),
-						Color: event.Color,
-						From: event.From,
+			for _, conv:= range m.Conversations{
+
+				for i:= range conv.Messages{
+
+					if conv.Messages[i].Mine && conv.Messages[i].ClientID == event.ClientID {
+						conv.Messages[i].ID = event.ID
 					}
-	
-					m.Messages = append(m.Messages, fmt.Sprintf("%s %s: %s", TimeStamp(), event.From, m.PointsSpinner.View()))
 				}
-					
-			}else{
-				
-				typing, ok:= m.EventTracking[event.From]
+			}
 
-				if ok{
-					m.Messages = slices.Delete(m.Messages, typing.Index, typing.Index+1)
-					delete(m.EventTracking, event.From)
-	
-					//reset indexes
-	
-					for _, otherTyping:= range m.EventTracking{
-						if otherTyping.Index >= typing.Index{
-							otherTyping.Index--
-						}
-					}
+			m.UpdateState(func(line Line) bool { return line.ClientID == event.ClientID }, ReceiptSent)
+			m.RenderMessages()
+
+			// Each held chat the server stores lets the next one go.
+			if m.Held[event.ClientID] {
+				delete(m.Held, event.ClientID)
+				return m, tea.Batch(m.ResendHeld(), RecvMessage(m.Client))
+			}
+
+			return m, RecvMessage(m.Client)
+
+		case protocol.ReceiptMessage:
+
+			// A receipt only counts in the conversation its reader is in.
+			if conv, ok:= m.Conversations[m.Key(Friend(event.By), event.Room)]; ok {
+				conv.UpdateState(func(line Line) bool { return line.ID == event.ID }, event.State)
+				m.RenderMessages()
+			}
+
+			return m, RecvMessage(m.Client)
+		
+		case protocol.FriendList:
+			m.Active = make([] Friend, len(event))
+
+			for i, friend:= range event{
+
+				m.Active[i] = Friend(friend)
+
+				if presence, ok:= m.Presence[string(friend)]; ok && presence.State == protocol.StateOffline {
+					m.Presence[string(friend)] = protocol.PresenceMessage{User: string(friend), State: protocol.StateOnline}
 				}
+			}
 
-				
+			m.SyncFriends()
+			return m, RecvMessage(m.Client)
+
+		case protocol.PresenceMessage:
+			m.Presence[event.User] = event
+
+			if event.State == protocol.StateOffline {
+				m.Active = slices.DeleteFunc(m.Active, func(friend Friend) bool {
+					return string(friend) == event.User
+				})
+			}else if !slices.Contains(m.Active, Friend(event.User)) {
+				m.Active = append(m.Active, Friend(event.User))
+			}
+
+			m.SyncFriends()
+			return m, RecvMessage(m.Client)
+
+		case protocol.RoomList:
+			m.Rooms.SetItems(RoomsToItems(event))
+			return m, RecvMessage(m.Client)
+
+		case protocol.ErrorMessage:
+			m.Notice = event.Message
+
+			if event.Type == protocol.TypeChat {
+
+				held:= m.Held[event.ClientID]
+
+				m.FailPending(event.ClientID)
+
+				// The next held chat should not wait on this one.
+				if held {
+					return m, tea.Batch(m.ResendHeld(), RecvMessage(m.Client))
+				}
+			}
+
+			return m, RecvMessage(m.Client)
+
+		case protocol.RateLimitedMessage:
+
+			// Dropped typing events only mean a friend misses a few dots.
+			wait:= time.Duration(event.RetryAfter) * time.Millisecond
+
+			if event.Type != protocol.TypeTyping {
+				m.Notice = fmt.Sprintf("Slow down! You can send again in %s", wait.Round(time.Second / 10))
+			}
+
+			// The chat stays pending and is sent again once we may.
+			if event.Type == protocol.TypeChat {
+				return m, tea.Batch(m.Hold(event.ClientID, wait), RecvMessage(m.Client))
 			}
 
-			m.ViewPort.SetContent(lipgloss.NewStyle().Width(m.ViewPort.Width).Render(strings.Join(m.Messages, gap)))
-			m.ViewPort.GotoBottom()
+			return m, RecvMessage(m.Client)
+
+		
+		case protocol.TypingMessage:
+			conv:= m.Conversation(Friend(event.From), event.Room)
+
+			if event.IsTyping{
+				conv.StartTyping(event)
+			}else{
+				conv.StopTyping(event.From)
+			}
+
+			m.RenderMessages()
 			
-			return m, ShortLiveRecv(m.RecvChan)
+			return m, RecvMessage(m.Client)
+
+		default:
+			return m, RecvMessage(m.Client)
 		
 		}
 
@@ -770,7 +1052,18 @@ func (m * Model) Update(msg tea.Msg) (tea.Model, tea.Cmd){
 	
 
 	m.Input, cmd = m.Input.Update(msg)
-	m.List, cmd = m.List.Update(msg)
+
+	var pwCmd tea.Cmd
+	m.Password, pwCmd = m.Password.Update(msg)
+
+	switch m.Focus {
+
+	case FocusRooms:
+		m.Rooms, cmd = m.Rooms.Update(msg)
+
+	case FocusFriends:
+		m.List, cmd = m.List.Update(msg)
+	}
 
 	var(
 		tiCmd tea.Cmd
@@ -778,48 +1071,59 @@ func (m * Model) Update(msg tea.Msg) (tea.Model, tea.Cmd){
 	)
 
 	m.TextArea, tiCmd = m.TextArea.Update(msg)
-	m.ViewPort, vpCmd = m.ViewPort.Update(msg)
+
+	// Keys only scroll the conversation when it has focus.
+	if _, key:= msg.(tea.KeyMsg); !key || m.Focus == FocusChat {
+		m.ViewPort, vpCmd = m.ViewPort.Update(msg)
+	}
 
 	return m, tea.Batch(
 		cmd,
+		pwCmd,
 		tiCmd,
 		vpCmd,
+		m.ReadVisible(),
 	)
 }
 
+// Split reports whether the friend and room lists are on screen, next to
+// the open conversation if there is one.
+func (m * Model) Split() bool {
+	return m.CurrWindow == 2 || m.CurrWindow == 3
+}
+
 func (m * Model) View() string {
 
+	if m.ExitMessage == "" && m.Split() {
+		return m.SplitView()
+	}
+
 	str:= "\n"
 
 	if m.ExitMessage == ""{
+
+		str+= m.ReconnectingView()
+
 		if m.CurrWindow == 0{
 
 			str+= lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(m.Theme))).Render(m.Input.View())
 	
-		}else if m.CurrWindow == 1{
-			str+=fmt.Sprintf("%s Connecting to server...\n\n", m.Spinner.View())
-		}else if m.CurrWindow == 2{
-	
-			if len(m.List.Items()) <= 0 {
-				str+=lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(m.Theme))).Render(fmt.Sprintf("%s Waiting for users... \n\n", m.Spinner.View()))
-			}else {
-				str+= m.List.View()
-			}
-	
-			
-		}else if m.CurrWindow == 3{
+		}else if m.CurrWindow == 5{
 
-			if len(m.Messages) == 0{
-				style:= lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(m.Theme)))
+			str+= lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(m.Theme))).Render(m.Password.View())
 
-					display:= fmt.Sprintf("Welcome to the %s's dm! Type a message and press Enter to send.", m.Friend)
-					m.ViewPort.SetContent(style.Render(display))
+			if m.Notice != ""{
+				str+= "\n" + warningStyle.Render(m.Notice)
 			}
-			str += fmt.Sprintf("%s%s%s", 
-			m.ViewPort.View(),
-			gap,
-			m.TextArea.View(),
-		)
+
+			str+= "\n" + helpStyle.Render("enter: log in • ctrl+r: register as " + m.WhoAmI + " • esc: quit")
+
+		}else if m.CurrWindow == 1{
+			str+=fmt.Sprintf("%s Connecting to server...\n\n", m.Spinner.View())
+		}else if m.CurrWindow == 4{
+
+			str+= lipgloss.NewStyle().Foreground(lipgloss.Color(strconv.Itoa(m.Theme))).Render(m.RoomInput.View())
+			str+= "\n" + helpStyle.Render("enter: create room • esc: back")
 
 		}
 	}else {
@@ -832,45 +1136,59 @@ func (m * Model) View() string {
 	
 }
 
-func InitLogger(){
+func main(){
+
+	command, options, args, err:= ParseArgs(os.Args[1:])
 
+	if err != nil {
+
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
 
-	files, err2:= os.ReadDir(".")
+		return
+	}
 
-	if err2 != nil {
-		panic(err2)
+	if err:= InitLogger(options.LogFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	for _, file:= range files{
+	if command == "send" {
 
-		if strings.HasPrefix(file.Name(), "chat"){
-			os.Remove(file.Name())
+		if err:= RunSend(options, strings.Join(args, " ")); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
-	}
 
-	fName:= fmt.Sprintf("chat-%d.log", rand.IntN(100))
-	file, err:= os.Create(fName)
+		return
+	}
 
-	if err != nil {
-		panic(err)
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", args[0])
+		os.Exit(2)
 	}
 
-	log.SetOutput(file)
-}
+	if options.Headless {
 
-func main(){
+		if err:= RunHeadless(options, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 
-	//InitLogger()
+		return
+	}
 
-	// if err:= godotenv.Load(".env"); err!= nil{
-	// 	panic(err)
-	// }	
+	DetectBackground()
 
-	var model tea.Model = InitialModel()
+	var model tea.Model = InitialModel(options)
 
 	p:= tea.NewProgram(model, tea.WithAltScreen())
 
 	if _, err:= p.Run(); err != nil {
-		//log.Println("Something went wrong")
+		log.Println(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/Ikenna-Okpala/chatty"
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+// States one of our own messages moves through before the server's
+// receipts take over.
+const (
+	StateFailed = "failed"
+	StateSending = "sending"
+	ReceiptSent = "sent"
+)
+
+var receiptRank = map[string] int{
+	StateFailed: 0,
+	StateSending: 1,
+	ReceiptSent: 2,
+	protocol.ReceiptDelivered: 3,
+	protocol.ReceiptRead: 4,
+}
+
+// Line is one entry in the conversation view: a message, or a friend's
+// typing indicator.
+type Line struct {
+	ID string
+	ClientID string
+	Time time.Time
+	From string
+	Room string
+	Text string
+	Color int
+	Mine bool
+	State string
+	Typing bool
+}
+
+// ChatLine turns a chat message into a line, timed by when it was sent
+// rather than when it reached us.
+func ChatLine(chat protocol.ChatMessage) Line {
+
+	sentAt:= time.Now()
+
+	if chat.SentAt > 0 {
+		sentAt = time.UnixMilli(chat.SentAt)
+	}
+
+	return Line{
+		ID: chat.ID,
+		ClientID: chat.ClientID,
+		Time: sentAt,
+		From: chat.From,
+		Room: chat.Room,
+		Text: chat.Text,
+		Color: chat.Color,
+	}
+}
+
+func FormatTime(t time.Time) string {
+	return fmt.Sprintf("[%d:%d]", t.Hour(), t.Minute())
+}
+
+func ReceiptMark(state string) string {
+
+	switch state {
+
+	case StateFailed:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Render("✗ not sent")
+
+	case StateSending:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("◌")
+
+	case ReceiptSent:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("✓")
+
+	case protocol.ReceiptDelivered:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("✓✓")
+
+	case protocol.ReceiptRead:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("39")).Render("✓✓")
+	}
+
+	return ""
+}
+
+// Render draws the line; dots is the current frame of the typing spinner.
+func (l Line) Render(dots string) string {
+
+	style:= lipgloss.NewStyle().Foreground(Foreground(l.Color))
+
+	from:= l.From
+
+	if l.Mine {
+		from = "You"
+	}
+
+	if l.Room != "" {
+		from = fmt.Sprintf("#%s %s", l.Room, from)
+	}
+
+	// Someone else's text must not reach the terminal as escape
+	// sequences, even from a server that let them through; line breaks
+	// stay.
+	lines:= strings.Split(l.Text, "\n")
+
+	for i, line:= range lines{
+		lines[i] = Clean(line)
+	}
+
+	text:= strings.Join(lines, "\n")
+
+	if l.Typing {
+		text = dots
+	}
+
+	str:= style.Render(fmt.Sprintf("%s %s: %s", FormatTime(l.Time), from, text))
+
+	if l.Mine {
+		str += " " + ReceiptMark(l.State)
+	}
+
+	return str
+}
+
+// RenderMessages redraws the open conversation, keeping up with the
+// latest line unless it was scrolled away from.
+func (m * Model) RenderMessages(){
+
+	if m.CurrWindow != 3 {
+		return
+	}
+
+	messages:= m.Current().Messages
+
+	rendered:= make([] string, len(messages))
+
+	for i, line:= range messages{
+		rendered[i] = line.Render(m.PointsSpinner.View())
+	}
+
+	follow:= m.ViewPort.AtBottom()
+
+	width:= max(0, m.ViewPort.Width - m.ViewPort.Style.GetHorizontalFrameSize())
+
+	m.ViewPort.SetContent(lipgloss.NewStyle().Width(width).Render(strings.Join(rendered, gap)))
+
+	if follow {
+		m.ViewPort.GotoBottom()
+	}
+}
+
+// UpdateState moves one of our messages forward to state, in whichever
+// conversation it is. Receipts can arrive out of order, so a message
+// never moves backwards.
+func (m * Model) UpdateState(match func(Line) bool, state string){
+
+	for _, conv:= range m.Conversations{
+		conv.UpdateState(match, state)
+	}
+}
+
+// UpdateState moves my messages in c that match on to state.
+func (c * Conversation) UpdateState(match func(Line) bool, state string){
+
+	for i:= range c.Messages{
+
+		line:= &c.Messages[i]
+
+		if line.Mine && match(*line) && receiptRank[state] > receiptRank[line.State] {
+			line.State = state
+		}
+	}
+}
+
+// ClearTyping drops every typing indicator, which may never be cleared
+// after the connection dropped.
+func (m * Model) ClearTyping(){
+
+	for _, conv:= range m.Conversations{
+		conv.ClearTyping()
+	}
+
+	m.RenderMessages()
+}
+
+// PopPending takes the message with clientID off those waiting for an ack.
+// A server that does not name the message means the oldest.
+func (m * Model) PopPending(clientID string) (string, bool) {
+
+	index:= 0
+
+	if clientID != "" {
+		index = slices.IndexFunc(m.Pending, func(chat protocol.ChatMessage) bool {
+			return chat.ClientID == clientID
+		})
+	}
+
+	if index < 0 || index >= len(m.Pending) {
+		return "", false
+	}
+
+	chat:= m.Pending[index]
+	m.Pending = slices.Delete(m.Pending, index, index + 1)
+
+	delete(m.Held, chat.ClientID)
+
+	return chat.ClientID, true
+}
+
+// FailPending marks the message with clientID as not sent, after the
+// server rejected or throttled it.
+func (m * Model) FailPending(clientID string){
+
+	clientID, ok:= m.PopPending(clientID)
+
+	if !ok {
+		return
+	}
+
+	for _, conv:= range m.Conversations{
+
+		for i:= range conv.Messages{
+
+			if conv.Messages[i].Mine && conv.Messages[i].ClientID == clientID {
+				conv.Messages[i].State = StateFailed
+			}
+		}
+	}
+
+	m.RenderMessages()
+}
+
+func SendReceipt(client * chatty.Client, chat protocol.ChatMessage) tea.Cmd {
+
+	return func() tea.Msg {
+
+		receipt:= protocol.ReceiptMessage{
+			ID: chat.ID,
+			State: protocol.ReceiptRead,
+			To: chat.From,
+			Room: chat.Room,
+		}
+
+		if err:= Send(client, receipt); err != nil {
+			return DisconnectedMsg{Client: client, err: err}
+		}
+
+		return nil
+	}
+}
+
+// ReadReceipts acknowledges every message that arrived in the open
+// conversation while it was closed or out of view.
+func (m * Model) ReadReceipts() tea.Cmd {
+
+	conv:= m.Current()
+
+	cmds:= make([] tea.Cmd, 0, len(conv.Unread))
+
+	for _, chat:= range conv.Unread{
+
+		if chat.ID != "" {
+			cmds = append(cmds, SendReceipt(m.Client, chat))
+		}
+	}
+
+	conv.Unread = nil
+
+	return tea.Batch(cmds...)
+}
+
+// ReadVisible sends the open conversation's read receipts once the user
+// can see them, and nothing until then.
+func (m * Model) ReadVisible() tea.Cmd {
+
+	if !m.Reading() || len(m.Current().Unread) == 0 {
+		return nil
+	}
+
+	return m.ReadReceipts()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+// Ways to be told about a message for a conversation that is not open.
+const (
+	NotifyOff = "off"
+	NotifyBell = "bell"
+	// NotifyOSC9 is the desktop notification of iTerm2, kitty, WezTerm
+	// and Windows Terminal.
+	NotifyOSC9 = "osc9"
+	// NotifyOSC777 is the desktop notification of rxvt-unicode and VTE
+	// terminals such as GNOME Terminal.
+	NotifyOSC777 = "osc777"
+)
+
+var notifyKinds = [] string{NotifyOff, NotifyBell, NotifyOSC9, NotifyOSC777}
+
+// previewLength bounds the text shown in a notification or a friend's
+// last message preview.
+const previewLength = 80
+
+const (
+	// Messages older than notifyStale are history being replayed, not news.
+	notifyStale = time.Minute
+	// notifyEvery is the least time between alerts for one conversation.
+	notifyEvery = 10 * time.Second
+)
+
+// Clean makes text from another user safe to write to the terminal: it
+// must not be able to end an escape sequence or start its own.
+func Clean(text string) string {
+
+	return strings.Map(func(r rune) rune {
+
+		if r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0) {
+			return ' '
+		}
+
+		return r
+	}, text)
+}
+
+// Shorten cuts text to n runes, marking that it was cut.
+func Shorten(text string, n int) string {
+
+	runes:= [] rune(text)
+
+	if len(runes) <= n {
+		return text
+	}
+
+	return string(runes[:n - 1]) + "…"
+}
+
+// Notification is the escape sequence that raises kind of notification.
+func Notification(kind string, title string, body string) string {
+
+	title = Clean(title)
+	body = Shorten(Clean(body), previewLength)
+
+	switch kind {
+
+	case NotifyBell:
+		return "\a"
+
+	case NotifyOSC9:
+		return fmt.Sprintf("\x1b]9;%s: %s\a", title, body)
+
+	case NotifyOSC777:
+		return fmt.Sprintf("\x1b]777;notify;%s;%s\a", strings.ReplaceAll(title, ";", ","), body)
+	}
+
+	return ""
+}
+
+// Notify tells the user about chat. It writes to stderr, which is the
+// terminal too, so the sequence cannot land inside a frame the UI is
+// drawing on stdout.
+func Notify(kind string, chat protocol.ChatMessage) tea.Cmd {
+
+	title:= chat.From
+
+	if chat.Room != "" {
+		title = fmt.Sprintf("%s in #%s", chat.From, chat.Room)
+	}
+
+	sequence:= Notification(kind, title, chat.Text)
+
+	if sequence == ""{
+		return nil
+	}
+
+	return func() tea.Msg {
+		fmt.Fprint(os.Stderr, sequence)
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/Ikenna-Okpala/chatty"
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+// idleAfter is how long without a key press before we tell friends we're away.
+const idleAfter = 5 * time.Minute
+
+type IdleCheckMsg struct{}
+
+func IdleCheck() tea.Cmd {
+
+	return tea.Tick(time.Minute, func(time.Time) tea.Msg {
+		return IdleCheckMsg{}
+	})
+}
+
+func SendPresence(client * chatty.Client, state string) tea.Cmd {
+
+	return func() tea.Msg {
+
+		if err:= Send(client, protocol.PresenceMessage{State: state}); err != nil {
+			return DisconnectedMsg{Client: client, err: err}
+		}
+
+		return nil
+	}
+}
+
+// LastSeen describes a unix time relative to now, e.g. "5m ago".
+func LastSeen(unix int64) string {
+
+	if unix == 0 {
+		return "a while ago"
+	}
+
+	since:= time.Since(time.Unix(unix, 0))
+
+	switch {
+	case since < time.Minute:
+		return "just now"
+	case since < time.Hour:
+		return fmt.Sprintf("%dm ago", int(since.Minutes()))
+	case since < time.Hour * 24:
+		return fmt.Sprintf("%dh ago", int(since.Hours()))
+	}
+
+	return fmt.Sprintf("%dd ago", int(since.Hours() / 24))
+}
+
+// PresenceBadge renders the dot shown before a friend's name and, for
+// offline friends, when they were last seen.
+func PresenceBadge(presence protocol.PresenceMessage) (string, string) {
+
+	switch presence.State {
+
+	case protocol.StateAway:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Render("◐"), ""
+
+	case protocol.StateOffline:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("○"), " · last seen " + LastSeen(presence.LastSeen)
+	}
+
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("46")).Render("●"), ""
+}
+
+// SyncFriends rebuilds the friend list: the connected users followed by
+// the offline friends we know about, most recently seen first, with the
+// friends we talked to most recently moved to the top. The cursor stays
+// on the friend it was on.
+func (m * Model) SyncFriends(){
+
+	friends:= slices.Clone(m.Active)
+
+	offline:= make([] protocol.PresenceMessage, 0)
+
+	for _, presence:= range m.Presence{
+
+		if presence.State == protocol.StateOffline && !slices.Contains(friends, Friend(presence.User)) {
+			offline = append(offline, presence)
+		}
+	}
+
+	slices.SortFunc(offline, func(a, b protocol.PresenceMessage) int {
+		return int(b.LastSeen - a.LastSeen)
+	})
+
+	for _, presence:= range offline{
+		friends = append(friends, Friend(presence.User))
+	}
+
+	// Friends we only know from a DM, whose presence we never heard.
+	for _, key:= range m.Order{
+
+		conv:= m.Conversations[key]
+
+		if conv.Room == "" && !conv.Active.IsZero() && !slices.Contains(friends, conv.Friend) {
+			friends = append(friends, conv.Friend)
+		}
+	}
+
+	active:= func(friend Friend) time.Time {
+
+		if conv:= m.DM(friend); conv != nil {
+			return conv.Active
+		}
+
+		return time.Time{}
+	}
+
+	slices.SortStableFunc(friends, func(a, b Friend) int {
+		return active(b).Compare(active(a))
+	})
+
+	selected, _:= m.List.SelectedItem().(Friend)
+
+	m.List.SetItems(FriendsToItems(friends))
+
+	if index:= slices.Index(friends, selected); index >= 0 {
+		m.List.Select(index)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/Ikenna-Okpala/chatty"
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+const (
+	reconnectBase = 500 * time.Millisecond
+	reconnectMax = 30 * time.Second
+)
+
+var ErrOffline = errors.New("Not connected")
+
+// DisconnectedMsg reports that Client broke. Errors from a connection we
+// have already replaced are ignored.
+type DisconnectedMsg struct{
+	Client * chatty.Client
+	err error
+}
+
+type ReconnectedMsg struct{
+	Client * chatty.Client
+}
+
+type ReconnectFailedMsg struct{
+	err error
+}
+
+// ExpiredMsg means the server no longer takes our token, so reconnecting
+// has to wait for the user to log in again.
+type ExpiredMsg struct{}
+
+// Backoff is the wait before reconnect attempt n: exponential up to
+// reconnectMax, with half of it jittered so clients dropped together do
+// not all come back at once.
+func Backoff(attempt int) time.Duration {
+
+	delay:= reconnectMax
+
+	if attempt < 16 {
+		delay = min(reconnectMax, reconnectBase << attempt)
+	}
+
+	return delay / 2 + rand.N(delay / 2 + 1)
+}
+
+// Fatal reports whether err means trying again would only fail again, and
+// what to tell the user about it.
+func Fatal(err error) (error, bool) {
+
+	if reason, refused:= chatty.Refused(err); refused {
+
+		if reason != ""{
+			return errors.New(reason), true
+		}
+
+		return err, true
+	}
+
+	if Expired(err) {
+		return err, true
+	}
+
+	return err, false
+}
+
+// Expired reports whether err is the server turning down our token,
+// because it expired or was revoked while we were away.
+func Expired(err error) bool {
+
+	statusErr:= new(chatty.StatusError)
+
+	return errors.As(err, &statusErr) && (statusErr.Status == http.StatusUnauthorized || statusErr.Status == http.StatusForbidden)
+}
+
+func Reconnect(whoAmI string, token string, delay time.Duration) tea.Cmd {
+
+	return func() tea.Msg {
+
+		time.Sleep(delay)
+
+		client, err:= chatty.Dial(context.Background(), server, whoAmI, token)
+
+		if err != nil {
+
+			if Expired(err) {
+				return ExpiredMsg{}
+			}
+
+			if fatal, ok:= Fatal(err); ok {
+				return ErrorMsg{err: fatal}
+			}
+
+			return ReconnectFailedMsg{err: err}
+		}
+
+		return ReconnectedMsg{Client: client}
+	}
+}
+
+// Resend sends every message the server has not acked yet, oldest first.
+// Each keeps its client id, so one the server already stored is only
+// acked again.
+func (m * Model) Resend() tea.Cmd {
+
+	cmds:= make([] tea.Cmd, 0, len(m.Pending))
+
+	for _, chat:= range m.Pending{
+		cmds = append(cmds, SendText(m.Client, chat))
+	}
+
+	return tea.Sequence(cmds...)
+}
+
+// RetryMsg means a rate limit on held chats has passed.
+type RetryMsg struct{}
+
+// Hold keeps a chat the server throttled pending instead of failing it,
+// and waits out the limit unless a wait is already running. A server that
+// does not name the chat means the oldest pending.
+func (m * Model) Hold(clientID string, wait time.Duration) tea.Cmd {
+
+	index:= 0
+
+	if clientID != "" {
+		index = slices.IndexFunc(m.Pending, func(chat protocol.ChatMessage) bool {
+			return chat.ClientID == clientID
+		})
+	}
+
+	if index < 0 || index >= len(m.Pending) {
+		return nil
+	}
+
+	m.Held[m.Pending[index].ClientID] = true
+
+	if m.Retrying {
+		return nil
+	}
+
+	m.Retrying = true
+
+	return tea.Tick(wait, func(time.Time) tea.Msg {
+		return RetryMsg{}
+	})
+}
+
+// ResendHeld sends the oldest held chat. Its ack sends the next, so a
+// backlog goes out as fast as the server takes it rather than all at once.
+func (m * Model) ResendHeld() tea.Cmd {
+
+	if m.Client == nil || m.Reconnecting {
+		return nil
+	}
+
+	for _, chat:= range m.Pending{
+
+		if m.Held[chat.ClientID] {
+			return SendText(m.Client, chat)
+		}
+	}
+
+	return nil
+}
+
+// ReconnectingView is the banner shown while the connection is down.
+func (m * Model) ReconnectingView() string {
+
+	// Logging in again comes first.
+	if !m.Reconnecting || m.CurrWindow == 5 {
+		return ""
+	}
+
+	return warningStyle.Render(m.Spinner.View() + " Reconnecting…") + "\n"
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/Ikenna-Okpala/chatty"
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+// Room is a protocol.Room as a list item.
+type Room struct {
+	protocol.Room
+}
+
+func (r Room) FilterValue() string {return ""}
+
+type RoomDelegate struct{
+	Theme int
+	Unread func(string) int
+}
+
+func (r RoomDelegate) Height() int{return 1}
+
+func (r RoomDelegate) Spacing() int {return 0}
+
+func (r RoomDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd {return nil}
+
+func (r RoomDelegate) Render(w io.Writer, m list.Model, index int, listRoom list.Item){
+
+	room, ok:= listRoom.(Room)
+
+	if !ok {
+		return
+	}
+
+	str:= fmt.Sprintf("%d. #%s", index + 1, room.Name)
+
+	if room.Joined {
+		str += " ✓"
+	}
+
+	if unread:= r.Unread(room.Name); unread > 0 {
+		str += fmt.Sprintf(" (%d)", unread)
+	}
+
+	fn:= itemStyle.Render
+
+	if m.Index() == index {
+		fn = func(strs ...string) string {
+
+			selectedItemStyle := lipgloss.NewStyle().PaddingLeft(2).Foreground(lipgloss.Color(strconv.Itoa(r.Theme)))
+			return selectedItemStyle.Render("> "+ strings.Join(strs, " "))
+		}
+	}
+
+	fmt.Fprint(w, lipgloss.NewStyle().MaxWidth(m.Width()).Render(fn(str)))
+}
+
+func RoomsToItems(rooms protocol.RoomList) [] list.Item {
+	items:= make([] list.Item, len(rooms))
+	for i, ele:= range rooms{
+		items[i] = Room{ele}
+	}
+
+	return items
+}
+
+// SendRoom asks the server to create, join, leave or list rooms. The server
+// answers with a fresh "rooms" frame.
+func SendRoom(client * chatty.Client, action string, name string) tea.Cmd {
+
+	return func() tea.Msg {
+
+		if err:= Send(client, protocol.RoomMessage{Action: action, Name: name}); err != nil {
+			return DisconnectedMsg{Client: client, err: err}
+		}
+
+		return nil
+	}
+}
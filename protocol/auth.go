@@ -0,0 +1,18 @@
+package protocol
+
+// Credentials are posted to /register and /login. Color, if set, becomes
+// the user's colour from then on.
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Color int `json:"color,omitempty"`
+}
+
+// TokenResponse carries a token for /chat/{id}, sent as a Bearer header
+// or a ?token= query parameter. Expires is in unix seconds. Color is the
+// user's colour, which the server stamps on everything they send.
+type TokenResponse struct {
+	Token string `json:"token"`
+	Expires int64 `json:"expires"`
+	Color int `json:"color,omitempty"`
+}
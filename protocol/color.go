@@ -0,0 +1,76 @@
+package protocol
+
+import "math"
+
+// Colours are indices into the 256-colour palette of xterm. Zero means no
+// colour was given.
+const (
+	MinColor = 1
+	MaxColor = 255
+)
+
+func ValidColor(color int) bool {
+	return color >= MinColor && color <= MaxColor
+}
+
+// ansi is how xterm draws the first 16 colours by default. Terminals let
+// users change them, so they are only a guess.
+var ansi = [16][3] uint8{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// cube is the intensity of each step of the 6x6x6 colour cube.
+var cube = [6] uint8{0, 95, 135, 175, 215, 255}
+
+// RGB is how xterm draws color, each channel from 0 to 255.
+func RGB(color int) (uint8, uint8, uint8) {
+
+	switch {
+
+	case color < 0 || color > MaxColor:
+		return 0, 0, 0
+
+	case color < 16:
+		return ansi[color][0], ansi[color][1], ansi[color][2]
+
+	case color < 232:
+		color -= 16
+		return cube[color / 36], cube[color / 6 % 6], cube[color % 6]
+	}
+
+	grey:= uint8(8 + 10 * (color - 232))
+
+	return grey, grey, grey
+}
+
+// Luminance is the relative luminance of an sRGB colour, as WCAG defines
+// it: 0 for black to 1 for white.
+func Luminance(r uint8, g uint8, b uint8) float64 {
+
+	linear:= func(c uint8) float64 {
+
+		v:= float64(c) / 255
+
+		if v <= 0.04045 {
+			return v / 12.92
+		}
+
+		return math.Pow((v + 0.055) / 1.055, 2.4)
+	}
+
+	return 0.2126 * linear(r) + 0.7152 * linear(g) + 0.0722 * linear(b)
+}
+
+// ColorLuminance is the luminance of color as xterm draws it.
+func ColorLuminance(color int) float64 {
+	return Luminance(RGB(color))
+}
+
+// Contrast is the WCAG contrast ratio of two luminances, from 1 for the
+// same colour to 21 for black on white.
+func Contrast(a float64, b float64) float64 {
+	return (max(a, b) + 0.05) / (min(a, b) + 0.05)
+}
@@ -0,0 +1,52 @@
+package protocol
+
+// MaxTextLength is the most runes a chat message may carry.
+const MaxTextLength = 280
+
+// Close codes the server ends a connection with when it will not take the
+// client back, so reconnecting would only fail again.
+const (
+	CloseSessionExists = 4009
+	CloseSessionReplaced = 4010
+	// CloseUnsupportedVersion means the client's protocol version is older
+	// than the server's MinVersion; the reason says what to upgrade to.
+	CloseUnsupportedVersion = 4011
+)
+
+// Codes sent in "error" frames so clients can tell failures apart.
+const (
+	CodeInvalidFrame = "invalid_frame"
+	CodeUnsupported = "unsupported"
+	CodeEmptyText = "empty_text"
+	CodeTooLong = "too_long"
+	CodeControl = "control_characters"
+	CodeNoRecipient = "no_recipient"
+	CodeNotMember = "not_member"
+	CodeRoom = "room"
+	CodeInternal = "internal"
+)
+
+// ErrorMessage is sent back to a client whose frame was rejected. Type is
+// the type of the rejected frame and, for a chat, ClientID names it.
+type ErrorMessage struct {
+	Code string `json:"code"`
+	Message string `json:"message"`
+	Type string `json:"type,omitempty"`
+	ClientID string `json:"clientId,omitempty"`
+}
+
+func (ErrorMessage) FrameType() string { return TypeError }
+
+func (e ErrorMessage) Error() string {
+	return e.Message
+}
+
+// RateLimitedMessage tells the client which frame type was dropped and
+// when, in milliseconds, it may send again. For a chat, ClientID names it.
+type RateLimitedMessage struct {
+	Type string `json:"type"`
+	RetryAfter int64 `json:"retryAfter"`
+	ClientID string `json:"clientId,omitempty"`
+}
+
+func (RateLimitedMessage) FrameType() string { return TypeRateLimited }
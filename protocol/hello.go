@@ -0,0 +1,86 @@
+package protocol
+
+import "slices"
+
+// Version is the protocol version this package speaks. Bump it when a
+// change would confuse a client built against the previous one; adding
+// a frame type behind a new feature does not need a bump.
+const Version = 1
+
+// Features a peer can list in its hello. Frames of a type tied to a
+// feature are only sent to clients that listed it, so new frame types can
+// ship without older clients seeing them.
+const (
+	FeatureTyping = "typing"
+	FeaturePresence = "presence"
+	FeatureRooms = "rooms"
+	FeatureAcks = "acks"
+	FeatureReceipts = "receipts"
+)
+
+// Features is everything this version of the package understands.
+var Features = [] string{
+	FeatureTyping,
+	FeaturePresence,
+	FeatureRooms,
+	FeatureAcks,
+	FeatureReceipts,
+}
+
+// HelloMessage is the first frame each side sends. A client says which
+// version it speaks and what it supports; the server answers with its own,
+// and the oldest client version it accepts as MinVersion.
+type HelloMessage struct {
+	Version int `json:"version"`
+	MinVersion int `json:"minVersion,omitempty"`
+	Features [] string `json:"features"`
+}
+
+func (HelloMessage) FrameType() string { return TypeHello }
+
+// Hello is the hello for this version of the package.
+func Hello() HelloMessage {
+
+	return HelloMessage{
+		Version: Version,
+		Features: slices.Clone(Features),
+	}
+}
+
+func (h HelloMessage) Supports(feature string) bool {
+	return slices.Contains(h.Features, feature)
+}
+
+// FeatureOf names the feature frames of frameType belong to, or "" for
+// frames every client understands.
+func FeatureOf(frameType string) string {
+
+	switch frameType {
+
+	case TypeTyping:
+		return FeatureTyping
+
+	case TypePresence:
+		return FeaturePresence
+
+	case TypeRooms, TypeRoom:
+		return FeatureRooms
+
+	case TypeAck:
+		return FeatureAcks
+
+	case TypeReceipt:
+		return FeatureReceipts
+	}
+
+	return ""
+}
+
+// Accepts reports whether a peer that said hello may be sent frames of
+// frameType.
+func (h HelloMessage) Accepts(frameType string) bool {
+
+	feature:= FeatureOf(frameType)
+
+	return feature == "" || h.Supports(feature)
+}
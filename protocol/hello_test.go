@@ -0,0 +1,37 @@
+package protocol
+
+import "testing"
+
+func TestHelloAccepts(t * testing.T){
+
+	legacy:= HelloMessage{}
+	typingOnly:= HelloMessage{Version: 1, Features: [] string{FeatureTyping}}
+
+	tests:= [] struct {
+		name string
+		hello HelloMessage
+		frameType string
+		accepts bool
+	}{
+		{"chat to a legacy client", legacy, TypeChat, true},
+		{"error to a legacy client", legacy, TypeError, true},
+		{"friends to a legacy client", legacy, TypeFriends, true},
+		{"typing to a legacy client", legacy, TypeTyping, false},
+		{"ack to a legacy client", legacy, TypeAck, false},
+		{"room to a legacy client", legacy, TypeRoom, false},
+		{"typing to a typing client", typingOnly, TypeTyping, true},
+		{"presence to a typing client", typingOnly, TypePresence, false},
+		{"receipt to a typing client", typingOnly, TypeReceipt, false},
+		{"rooms to a current client", Hello(), TypeRooms, true},
+		{"room to a current client", Hello(), TypeRoom, true},
+		{"receipt to a current client", Hello(), TypeReceipt, true},
+		{"unknown type to a legacy client", legacy, "shout", true},
+	}
+
+	for _, test:= range tests{
+
+		if accepts:= test.hello.Accepts(test.frameType); accepts != test.accepts {
+			t.Errorf("%s: Accepts(%q) = %v, want %v", test.name, test.frameType, accepts, test.accepts)
+		}
+	}
+}
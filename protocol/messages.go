@@ -0,0 +1,131 @@
+package protocol
+
+// ChatMessage is a message to a user or a room. ID is assigned by the
+// server; ClientID and SentAt are set by the sending client so a resend
+// can be recognised.
+type ChatMessage struct {
+	ID string `json:"id,omitempty"`
+	ClientID string `json:"clientId,omitempty"`
+	SentAt int64 `json:"sentAt,omitempty"`
+	To string `json:"to"`
+	Room string `json:"room,omitempty"`
+	From string `json:"from"`
+	Text string `json:"text"`
+	Color int `json:"color"`
+}
+
+func (ChatMessage) FrameType() string { return TypeChat }
+
+// Conversation names are namespaced, so a DM can never share a name with a
+// room whatever its users are called.
+const (
+	DMPrefix = "dm:"
+	RoomPrefix = "room:"
+)
+
+// Conversation names a direct conversation independently of who sent the
+// message.
+func Conversation(a string, b string) string {
+
+	if a > b {
+		a, b = b, a
+	}
+
+	return DMPrefix + a + ":" + b
+}
+
+// RoomConversation names the conversation in room.
+func RoomConversation(room string) string {
+	return RoomPrefix + room
+}
+
+// Conversation names the conversation a message belongs to: its room, or
+// the direct conversation between sender and recipient.
+func (chat ChatMessage) Conversation() string {
+
+	if chat.Room != "" {
+		return RoomConversation(chat.Room)
+	}
+
+	return Conversation(chat.From, chat.To)
+}
+
+type TypingMessage struct {
+	IsTyping bool `json:"isTyping"`
+	To string `json:"to"`
+	Room string `json:"room,omitempty"`
+	Color int `json:"color"`
+	From string `json:"from"`
+}
+
+func (TypingMessage) FrameType() string { return TypeTyping }
+
+// FriendList is everyone connected, sent once when a connection opens.
+// Presence frames keep it current after that.
+type FriendList [] string
+
+func (FriendList) FrameType() string { return TypeFriends }
+
+// Presence states.
+const (
+	StateOnline = "online"
+	StateAway = "away"
+	StateOffline = "offline"
+)
+
+// PresenceMessage tells clients a user's state changed. LastSeen, in unix
+// seconds, is only set for offline users. Color is the user's colour.
+// Clients send it with just State to go away or come back.
+type PresenceMessage struct {
+	User string `json:"user"`
+	State string `json:"state"`
+	LastSeen int64 `json:"lastSeen,omitempty"`
+	Color int `json:"color,omitempty"`
+}
+
+func (PresenceMessage) FrameType() string { return TypePresence }
+
+type Room struct {
+	Name string `json:"name"`
+	Joined bool `json:"joined"`
+}
+
+// RoomList is every room, marked with whether the receiver has joined it.
+type RoomList [] Room
+
+func (RoomList) FrameType() string { return TypeRooms }
+
+// RoomMessage asks the server to create, join, leave or list rooms.
+type RoomMessage struct {
+	Action string `json:"action"`
+	Name string `json:"name"`
+}
+
+func (RoomMessage) FrameType() string { return TypeRoom }
+
+// Receipt states, in the order a message moves through them.
+const (
+	ReceiptDelivered = "delivered"
+	ReceiptRead = "read"
+)
+
+// AckMessage tells the sender the id the server assigned to the message
+// it sent as ClientID.
+type AckMessage struct {
+	ID string `json:"id"`
+	ClientID string `json:"clientId,omitempty"`
+}
+
+func (AckMessage) FrameType() string { return TypeAck }
+
+// ReceiptMessage is routed to To, the original sender of message ID; By is
+// who received or read it.
+type ReceiptMessage struct {
+	ID string `json:"id"`
+	State string `json:"state"`
+	By string `json:"by"`
+	To string `json:"to"`
+	Room string `json:"room,omitempty"`
+}
+
+func (ReceiptMessage) FrameType() string { return TypeReceipt }
@@ -0,0 +1,167 @@
+// Package protocol is the wire format shared by the chatty server and its
+// clients. Every websocket frame is a MessageWrapper whose Value is one of
+// the message types in this package.
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Frame types, the Type of a MessageWrapper.
+const (
+	TypeChat = "chat"
+	TypeTyping = "typing"
+	TypeFriends = "friends"
+	TypePresence = "presence"
+	TypeRooms = "rooms"
+	TypeRoom = "room"
+	TypeError = "error"
+	TypeRateLimited = "rate_limited"
+	TypeAck = "ack"
+	TypeReceipt = "receipt"
+	TypeHello = "hello"
+)
+
+type MessageWrapper struct{
+	Type string `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Message is a value that can be sent in a frame.
+type Message interface {
+	FrameType() string
+}
+
+// Wrap puts msg in a frame of its type.
+func Wrap(msg Message) (MessageWrapper, error) {
+
+	raw, err:= json.Marshal(msg)
+
+	if err != nil {
+		return MessageWrapper{}, err
+	}
+
+	return MessageWrapper{
+		Type: msg.FrameType(),
+		Value: raw,
+	}, nil
+}
+
+// Encode wraps msg and marshals the frame, ready to write or publish.
+func Encode(msg Message) ([] byte, error) {
+
+	frame, err:= Wrap(msg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(frame)
+}
+
+// Unwrap decodes the value of frame into the message type it names.
+func Unwrap(frame MessageWrapper) (Message, error) {
+
+	var msg Message
+
+	switch frame.Type {
+
+	case TypeChat:
+		msg = &ChatMessage{}
+
+	case TypeTyping:
+		msg = &TypingMessage{}
+
+	case TypeFriends:
+		msg = &FriendList{}
+
+	case TypePresence:
+		msg = &PresenceMessage{}
+
+	case TypeRooms:
+		msg = &RoomList{}
+
+	case TypeRoom:
+		msg = &RoomMessage{}
+
+	case TypeError:
+		msg = &ErrorMessage{}
+
+	case TypeRateLimited:
+		msg = &RateLimitedMessage{}
+
+	case TypeAck:
+		msg = &AckMessage{}
+
+	case TypeReceipt:
+		msg = &ReceiptMessage{}
+
+	case TypeHello:
+		msg = &HelloMessage{}
+
+	default:
+		return nil, fmt.Errorf("unknown frame type %q", frame.Type)
+	}
+
+	if err:= json.Unmarshal(frame.Value, msg); err != nil {
+		return nil, err
+	}
+
+	return deref(msg), nil
+}
+
+// Decode parses a raw frame into its message.
+func Decode(raw [] byte) (Message, error) {
+
+	frame:= MessageWrapper{}
+
+	if err:= json.Unmarshal(raw, &frame); err != nil {
+		return nil, err
+	}
+
+	return Unwrap(frame)
+}
+
+// deref hands messages out by value, so callers can switch on the plain
+// types.
+func deref(msg Message) Message {
+
+	switch m:= msg.(type) {
+
+	case *ChatMessage:
+		return *m
+
+	case *TypingMessage:
+		return *m
+
+	case *FriendList:
+		return *m
+
+	case *PresenceMessage:
+		return *m
+
+	case *RoomList:
+		return *m
+
+	case *RoomMessage:
+		return *m
+
+	case *ErrorMessage:
+		return *m
+
+	case *RateLimitedMessage:
+		return *m
+
+	case *AckMessage:
+		return *m
+
+	case *ReceiptMessage:
+		return *m
+
+	case *HelloMessage:
+		return *m
+	}
+
+	return msg
+}
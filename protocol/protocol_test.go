@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWrapDecode(t * testing.T){
+
+	tests:= [] Message{
+		ChatMessage{ID: "1-0", ClientID: "c1", SentAt: 1700000000000, To: "bob", From: "amy", Text: "hi", Color: 39},
+		ChatMessage{Room: "general", From: "amy", Text: "héllo 👋", Color: 198},
+		TypingMessage{IsTyping: true, To: "bob", From: "amy", Color: 39},
+		FriendList{"amy", "bob"},
+		PresenceMessage{User: "amy", State: StateAway, LastSeen: 1700000000000, Color: 39},
+		RoomList{{Name: "general", Joined: true}, {Name: "random"}},
+		RoomMessage{Action: "join", Name: "general"},
+		ErrorMessage{Code: CodeTooLong, Message: "Message is too long", Type: TypeChat, ClientID: "c1"},
+		RateLimitedMessage{Type: TypeChat, RetryAfter: 1500, ClientID: "c1"},
+		AckMessage{ID: "1-0", ClientID: "c1"},
+		ReceiptMessage{ID: "1-0", State: ReceiptRead, By: "bob", To: "amy"},
+		Hello(),
+	}
+
+	for _, msg:= range tests{
+
+		t.Run(msg.FrameType(), func(t * testing.T){
+
+			frame, err:= Wrap(msg)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if frame.Type != msg.FrameType() {
+				t.Errorf("frame type = %q, want %q", frame.Type, msg.FrameType())
+			}
+
+			raw, err:= Encode(msg)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, err:= Decode(raw)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(decoded, msg) {
+				t.Errorf("decoded %#v, want %#v", decoded, msg)
+			}
+
+			unwrapped, err:= Unwrap(frame)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(unwrapped, msg) {
+				t.Errorf("unwrapped %#v, want %#v", unwrapped, msg)
+			}
+		})
+	}
+}
+
+func TestDecodeRejects(t * testing.T){
+
+	tests:= map[string] string{
+		"not json": `chat`,
+		"unknown type": `{"type":"shout","value":{}}`,
+		"no type": `{"value":{"text":"hi"}}`,
+		"wrong value": `{"type":"chat","value":"hi"}`,
+	}
+
+	for name, raw:= range tests{
+
+		if msg, err:= Decode([]byte(raw)); err == nil {
+			t.Errorf("%s: Decode(%s) = %#v, want an error", name, raw, msg)
+		}
+	}
+}
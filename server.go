@@ -0,0 +1,87 @@
+// Package chatty is a client for the chatty server, for bots and for the
+// chatty TUI alike.
+//
+//	token, err:= chatty.Login(ctx, server, "ci", password)
+//	client, err:= chatty.Dial(ctx, server, "ci", token.Token)
+//	defer client.Close()
+//
+//	client.Send(ctx, chatty.NewChat("ci", "bob", "", "build finished", 39))
+//
+//	for event:= range client.Events(){
+//		if chat, ok:= event.(protocol.ChatMessage); ok {
+//			fmt.Println(chat.From, chat.Text)
+//		}
+//	}
+package chatty
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Server says where a chatty server is and how to reach it.
+type Server struct {
+	// Host is host[:port].
+	Host string
+	// Scheme is ws for a plain local server, wss otherwise.
+	Scheme string
+	// TLSConfig, if set, is used for both the auth endpoints and the
+	// websocket.
+	TLSConfig * tls.Config
+}
+
+// HTTPScheme is the scheme for the auth endpoints, matching the websocket's.
+func (s Server) HTTPScheme() string {
+
+	if s.Scheme == "ws" {
+		return "http"
+	}
+
+	return "https"
+}
+
+func (s Server) URL(path string) string {
+
+	u:= url.URL{
+		Scheme: s.Scheme,
+		Host: s.Host,
+		Path: path,
+	}
+
+	return u.String()
+}
+
+func (s Server) HTTPURL(path string) string {
+
+	u:= url.URL{
+		Scheme: s.HTTPScheme(),
+		Host: s.Host,
+		Path: path,
+	}
+
+	return u.String()
+}
+
+func (s Server) httpClient() * http.Client {
+
+	return &http.Client{
+		Timeout: time.Second * 10,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: s.TLSConfig,
+		},
+	}
+}
+
+func (s Server) dialer() * websocket.Dialer {
+
+	return &websocket.Dialer{
+		Proxy: http.ProxyFromEnvironment,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+		TLSClientConfig: s.TLSConfig,
+	}
+}
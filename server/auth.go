@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const defaultTokenTTL = 24 * time.Hour
+
+type Claims struct {
+	Subject string `json:"sub"`
+	Expires int64 `json:"exp"`
+}
+
+var username = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// Reserved names collide with the Redis channels every connection subscribes to.
+var reserved = [] string{"all", roomsUpdates, presenceUpdates}
+
+// AuthLimit is how often one address may try to log in or register.
+var AuthLimit = Limit{Rate: 0.2, Burst: 10}
+
+// wrongCredentials answers a bad username and a bad password alike, so
+// nobody can find out which accounts exist by logging in.
+const wrongCredentials = "Wrong username or password"
+
+// dummyHash is compared against when the user does not exist, so that
+// takes as long as a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("chatty"), bcrypt.DefaultCost)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+var ErrExpiredToken = errors.New("expired token")
+
+func userKey(id string) string {
+	return "user:" + id
+}
+
+var ErrUnknownUser = Reject(protocol.CodeNoRecipient, "No such user")
+
+// IsUser reports whether id has registered.
+func (ws * WsServer) IsUser(ctx context.Context, id string) (bool, error) {
+
+	exists, err:= ws.Redis.Exists(ctx, userKey(id)).Result()
+
+	return exists == 1, err
+}
+
+// TokenTTL reads how long issued tokens stay valid from TOKEN_TTL,
+// falling back to defaultTokenTTL when it is unset or invalid.
+func TokenTTL() time.Duration {
+	return envDuration("TOKEN_TTL", defaultTokenTTL)
+}
+
+func TokenSecret() [] byte {
+
+	secret:= os.Getenv("TOKEN_SECRET")
+
+	FailOnEnv(secret)
+
+	return []byte(secret)
+}
+
+func (ws * WsServer) sign(payload string) string {
+
+	mac:= hmac.New(sha256.New, ws.Secret)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IssueToken signs a token that lets id open /chat/{id} until it expires.
+func (ws * WsServer) IssueToken(id string) (protocol.TokenResponse, error) {
+
+	claims:= Claims{
+		Subject: id,
+		Expires: time.Now().Add(ws.TokenTTL).Unix(),
+	}
+
+	raw, err:= json.Marshal(claims)
+
+	if err != nil {
+		return protocol.TokenResponse{}, err
+	}
+
+	payload:= base64.RawURLEncoding.EncodeToString(raw)
+
+	return protocol.TokenResponse{
+		Token: payload + "." + ws.sign(payload),
+		Expires: claims.Expires,
+	}, nil
+}
+
+// VerifyToken checks the signature and expiry of token and returns its subject.
+func (ws * WsServer) VerifyToken(token string) (string, error) {
+
+	payload, signature, ok:= strings.Cut(token, ".")
+
+	if !ok {
+		return "", ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(ws.sign(payload))) {
+		return "", ErrInvalidToken
+	}
+
+	raw, err:= base64.RawURLEncoding.DecodeString(payload)
+
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	claims:= new(Claims)
+
+	if err:= json.Unmarshal(raw, claims); err != nil {
+		return "", ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.Expires {
+		return "", ErrExpiredToken
+	}
+
+	return claims.Subject, nil
+}
+
+// RequestToken pulls the token from the Authorization header, or from the
+// token query parameter for clients that cannot set headers on an upgrade.
+func RequestToken(r * http.Request) string {
+
+	if bearer, ok:= strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return bearer
+	}
+
+	return r.URL.Query().Get("token")
+}
+
+// ClientIP is the address a request came from. Behind a proxy, such as
+// Fly's, set CLIENT_IP_HEADER to the header it puts the real one in, e.g.
+// Fly-Client-IP; otherwise every client looks like the proxy.
+func ClientIP(r * http.Request) string {
+
+	if header:= os.Getenv("CLIENT_IP_HEADER"); header != ""{
+
+		if ip:= r.Header.Get(header); ip != ""{
+			return ip
+		}
+	}
+
+	host, _, err:= net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// AllowAuth spends one of the caller's attempts at logging in or
+// registering, answering 429 when they are out.
+func (ws * WsServer) AllowAuth(w http.ResponseWriter, r * http.Request) bool {
+
+	allowed, retryAfter, err:= ws.Take(r.Context(), rateLimitKey(ClientIP(r), "auth"), AuthLimit)
+
+	if err != nil {
+		fmt.Println(err)
+		return true
+	}
+
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds()) + 1))
+		http.Error(w, "Too many attempts, try again later", http.StatusTooManyRequests)
+	}
+
+	return allowed
+}
+
+// CheckOrigin accepts non-browser clients, same-origin requests and any
+// origin listed in ALLOWED_ORIGINS.
+func CheckOrigin(r * http.Request) bool {
+
+	origin:= r.Header.Get("Origin")
+
+	if origin == ""{
+		return true
+	}
+
+	u, err:= url.Parse(origin)
+
+	if err != nil {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	allowed:= strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+
+	return slices.Contains(allowed, origin)
+}
+
+func readCredentials(w http.ResponseWriter, r * http.Request) (* protocol.Credentials, bool) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	credentials:= new(protocol.Credentials)
+
+	if err:= json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(credentials); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if credentials.Username == "" || credentials.Password == ""{
+		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if credentials.Color != 0 && !protocol.ValidColor(credentials.Color) {
+		http.Error(w, fmt.Sprintf("Colour must be between %d and %d", protocol.MinColor, protocol.MaxColor), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return credentials, true
+}
+
+// writeToken answers with a token for credentials.Username, after saving
+// the colour they asked for, if any.
+func (ws * WsServer) writeToken(w http.ResponseWriter, r * http.Request, credentials * protocol.Credentials){
+
+	id:= credentials.Username
+
+	if credentials.Color != 0 {
+		if err:= ws.SetUserColor(r.Context(), id, credentials.Color); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	token, err:= ws.IssueToken(id)
+
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Could not issue token", http.StatusInternalServerError)
+		return
+	}
+
+	if token.Color, err = ws.UserColor(r.Context(), id); err != nil {
+		fmt.Println(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err:= json.NewEncoder(w).Encode(token); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func (ws * WsServer) Register(w http.ResponseWriter, r * http.Request){
+
+	if !ws.AllowAuth(w, r) {
+		return
+	}
+
+	credentials, ok:= readCredentials(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !username.MatchString(credentials.Username) || slices.Contains(reserved, credentials.Username) {
+		http.Error(w, "Usernames are 1-32 letters, digits, '-' or '_'", http.StatusBadRequest)
+		return
+	}
+
+	hash, err:= bcrypt.GenerateFromPassword([]byte(credentials.Password), bcrypt.DefaultCost)
+
+	if err != nil {
+		http.Error(w, "Invalid password", http.StatusBadRequest)
+		return
+	}
+
+	created, err:= ws.Redis.HSetNX(r.Context(), userKey(credentials.Username), "password", hash).Result()
+
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Could not register", http.StatusInternalServerError)
+		return
+	}
+
+	if !created {
+		http.Error(w, "Username taken", http.StatusConflict)
+		return
+	}
+
+	ws.writeToken(w, r, credentials)
+}
+
+func (ws * WsServer) Login(w http.ResponseWriter, r * http.Request){
+
+	if !ws.AllowAuth(w, r) {
+		return
+	}
+
+	credentials, ok:= readCredentials(w, r)
+
+	if !ok {
+		return
+	}
+
+	hash, err:= ws.Redis.HGet(r.Context(), userKey(credentials.Username), "password").Result()
+
+	if errors.Is(err, redis.Nil) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(credentials.Password))
+		http.Error(w, wrongCredentials, http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Could not log in", http.StatusInternalServerError)
+		return
+	}
+
+	if err:= bcrypt.CompareHashAndPassword([]byte(hash), []byte(credentials.Password)); err != nil {
+		http.Error(w, wrongCredentials, http.StatusUnauthorized)
+		return
+	}
+
+	ws.writeToken(w, r, credentials)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+	"github.com/redis/go-redis/v9"
+)
+
+// colorField holds a user's colour in their user hash.
+const colorField = "color"
+
+// legibleContrast is the contrast a colour we hand out must keep against
+// both a black and a white background, since we cannot know which the
+// user's friends have.
+const legibleContrast = 3
+
+// Palette is what new users get their colour from: the colour cube without
+// its greys, and only colours readable on dark and light terminals.
+var Palette = palette()
+
+func palette() [] int {
+
+	colors:= make([] int, 0)
+
+	for color:= 16; color < 232; color++ {
+
+		r, g, b:= protocol.RGB(color)
+
+		if r == g && g == b {
+			continue
+		}
+
+		l:= protocol.ColorLuminance(color)
+
+		if protocol.Contrast(l, 0) >= legibleContrast && protocol.Contrast(l, 1) >= legibleContrast {
+			colors = append(colors, color)
+		}
+	}
+
+	return colors
+}
+
+// UserColor is id's colour, picked from Palette the first time it is
+// needed and kept from then on.
+func (ws * WsServer) UserColor(ctx context.Context, id string) (int, error) {
+
+	color, err:= ws.Redis.HGet(ctx, userKey(id), colorField).Int()
+
+	if err == nil {
+		return color, nil
+	}
+
+	if !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	// Only set it if no other connection picked one meanwhile, then read
+	// back whichever won.
+	if err:= ws.Redis.HSetNX(ctx, userKey(id), colorField, Palette[rand.IntN(len(Palette))]).Err(); err != nil {
+		return 0, err
+	}
+
+	return ws.Redis.HGet(ctx, userKey(id), colorField).Int()
+}
+
+// SetUserColor changes id's colour for good.
+func (ws * WsServer) SetUserColor(ctx context.Context, id string, color int) error {
+	return ws.Redis.HSet(ctx, userKey(id), colorField, color).Err()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultDedupeTTL = 10 * time.Minute
+
+// maxClientIDLength leaves room for a UUID in any of its usual spellings.
+const maxClientIDLength = 64
+
+// DedupeTTL is how long a client message id is remembered. A client
+// resending within this window gets the original ack instead of a copy.
+func DedupeTTL() time.Duration {
+	return envDuration("DEDUPE_TTL", defaultDedupeTTL)
+}
+
+func dedupeKey(id string, clientID string) string {
+	return "dedupe:" + id + ":" + clientID
+}
+
+// ClaimMessage records that id sent clientID. It returns false with the
+// id the server assigned, empty while the first copy is still being
+// stored, when clientID was already seen.
+func (ws * WsServer) ClaimMessage(ctx context.Context, id string, clientID string) (bool, string, error) {
+
+	claimed, err:= ws.Redis.SetNX(ctx, dedupeKey(id, clientID), "", ws.DedupeTTL).Result()
+
+	if err != nil || claimed {
+		return claimed, "", err
+	}
+
+	stored, err:= ws.Redis.Get(ctx, dedupeKey(id, clientID)).Result()
+
+	if err == redis.Nil {
+		return false, "", nil
+	}
+
+	return false, stored, err
+}
+
+// StoreMessageID remembers the id assigned to clientID so a resend can be
+// acked with it.
+func (ws * WsServer) StoreMessageID(ctx context.Context, id string, clientID string, messageID string) error {
+	return ws.Redis.Set(ctx, dedupeKey(id, clientID), messageID, redis.KeepTTL).Err()
+}
+
+// ReleaseMessage forgets clientID after storing it failed, so the client
+// can retry.
+func (ws * WsServer) ReleaseMessage(ctx context.Context, id string, clientID string) error {
+	return ws.Redis.Del(ctx, dedupeKey(id, clientID)).Err()
+}
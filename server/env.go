@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// envDuration reads a positive duration from the env var name, falling
+// back to fallback when it is unset or invalid.
+func envDuration(name string, fallback time.Duration) time.Duration {
+
+	value:= os.Getenv(name)
+
+	if value == ""{
+		return fallback
+	}
+
+	d, err:= time.ParseDuration(value)
+
+	if err != nil || d <= 0 {
+		fmt.Println("Invalid "+name+", using default:", value)
+		return fallback
+	}
+
+	return d
+}
+
+// envInt reads an integer from low to high from the env var name, falling
+// back to fallback when it is unset, invalid or out of range.
+func envInt(name string, fallback int64, low int64, high int64) int64 {
+
+	value:= os.Getenv(name)
+
+	if value == ""{
+		return fallback
+	}
+
+	n, err:= strconv.ParseInt(value, 10, 64)
+
+	if err != nil || n < low || n > high {
+		fmt.Println("Invalid "+name+", using default:", value)
+		return fallback
+	}
+
+	return n
+}
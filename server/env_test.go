@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnvDuration(t * testing.T){
+
+	tests:= [] struct {
+		value string
+		want time.Duration
+	}{
+		{"", time.Minute},
+		{"90s", 90 * time.Second},
+		{"1h30m", 90 * time.Minute},
+		{"soon", time.Minute},
+		{"0s", time.Minute},
+		{"-5m", time.Minute},
+		{"30", time.Minute},
+	}
+
+	for _, test:= range tests{
+
+		t.Setenv("CHATTY_TEST_DURATION", test.value)
+
+		if got:= envDuration("CHATTY_TEST_DURATION", time.Minute); got != test.want {
+			t.Errorf("envDuration(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestEnvInt(t * testing.T){
+
+	tests:= [] struct {
+		value string
+		want int64
+	}{
+		{"", 10},
+		{"1", 1},
+		{"5", 5},
+		{"0", 10},
+		{"6", 10},
+		{"-1", 10},
+		{"2.5", 10},
+		{"many", 10},
+	}
+
+	for _, test:= range tests{
+
+		t.Setenv("CHATTY_TEST_INT", test.value)
+
+		if got:= envInt("CHATTY_TEST_INT", 10, 1, 5); got != test.want {
+			t.Errorf("envInt(%q) = %d, want %d", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// helloWait is how long a new connection has to say hello. Clients from
+// before the handshake never do, and are treated as version 0.
+const helloWait = 5 * time.Second
+
+// MinClientVersion is the oldest protocol version the server accepts,
+// from env MIN_CLIENT_VERSION. It defaults to protocol.Version.
+func MinClientVersion() int {
+	return int(envInt("MIN_CLIENT_VERSION", protocol.Version, 1, protocol.Version))
+}
+
+// ServerHello is what the server answers a client's hello with.
+func (ws * WsServer) ServerHello() protocol.HelloMessage {
+
+	hello:= protocol.Hello()
+	hello.MinVersion = ws.MinClientVersion
+
+	return hello
+}
+
+// Handshake reads the client's hello. A client that stays quiet or sends
+// something else first is from before the handshake, version 0.
+func (ws * WsServer) Handshake(conn * websocket.Conn) (protocol.HelloMessage, error) {
+
+	legacy:= protocol.HelloMessage{}
+
+	if err:= conn.SetReadDeadline(time.Now().Add(helloWait)); err != nil {
+		return legacy, err
+	}
+
+	_, raw, err:= conn.ReadMessage()
+
+	if err != nil {
+
+		if netErr, ok:= err.(net.Error); ok && netErr.Timeout() {
+			return legacy, nil
+		}
+
+		return legacy, err
+	}
+
+	frame:= protocol.MessageWrapper{}
+
+	if err:= json.Unmarshal(raw, &frame); err != nil || frame.Type != protocol.TypeHello {
+		return legacy, nil
+	}
+
+	hello:= protocol.HelloMessage{}
+
+	if err:= json.Unmarshal(frame.Value, &hello); err != nil {
+		return legacy, nil
+	}
+
+	return hello, conn.SetReadDeadline(time.Time{})
+}
+
+// Unsupported is the close reason for a client older than MinClientVersion.
+func (ws * WsServer) Unsupported(hello protocol.HelloMessage) string {
+	return fmt.Sprintf("Protocol v%d is no longer supported, this server needs v%d or newer. Please upgrade chatty.", hello.Version, ws.MinClientVersion)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultHistoryLimit = 1000
+
+// replayWindow is how many of the latest messages per conversation every
+// new session is sent, whatever the user's other devices already had, so
+// a device that was not connected for them still shows the conversation.
+const replayWindow = 50
+
+// HistoryLimit reads the per-conversation retention from HISTORY_LIMIT,
+// falling back to defaultHistoryLimit when it is unset or invalid.
+func HistoryLimit() int64 {
+	return envInt("HISTORY_LIMIT", defaultHistoryLimit, 1, math.MaxInt64)
+}
+
+func HistoryKey(conversation string) string {
+	return "history:" + conversation
+}
+
+// cursorKey holds, per conversation, the last message delivered to any of
+// the user's devices. It only decides which messages still owe their
+// sender a delivered receipt; what a session is sent is not limited by it.
+func cursorKey(id string) string {
+	return "history:cursor:" + id
+}
+
+func conversationsKey(id string) string {
+	return "history:conversations:" + id
+}
+
+// StreamIDLess reports whether stream entry a was added before b.
+func StreamIDLess(a string, b string) bool {
+
+	aMs, aSeq, _:= strings.Cut(a, "-")
+	bMs, bSeq, _:= strings.Cut(b, "-")
+
+	aTime, _:= strconv.ParseUint(aMs, 10, 64)
+	bTime, _:= strconv.ParseUint(bMs, 10, 64)
+
+	if aTime != bTime {
+		return aTime < bTime
+	}
+
+	aN, _:= strconv.ParseUint(aSeq, 10, 64)
+	bN, _:= strconv.ParseUint(bSeq, 10, 64)
+
+	return aN < bN
+}
+
+// AppendHistory stores the message in its conversation stream and sets
+// chat.ID to the entry id Redis assigned.
+func (ws * WsServer) AppendHistory(ctx context.Context, chat * protocol.ChatMessage) error {
+
+	conversation:= chat.Conversation()
+
+	id, err:= ws.Redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: HistoryKey(conversation),
+		MaxLen: ws.HistoryLimit,
+		Approx: true,
+		Values: map[string]any{
+			"from": chat.From,
+			"to": chat.To,
+			"room": chat.Room,
+			"text": chat.Text,
+			"color": chat.Color,
+			"clientId": chat.ClientID,
+			"sentAt": chat.SentAt,
+		},
+	}).Result()
+
+	if err != nil {
+		return err
+	}
+
+	chat.ID = id
+
+	if chat.Room != "" {
+		return nil
+	}
+
+	pipe:= ws.Redis.Pipeline()
+	pipe.SAdd(ctx, conversationsKey(chat.From), conversation)
+	pipe.SAdd(ctx, conversationsKey(chat.To), conversation)
+
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+// Delivered reports whether the user's cursor is already at or past the message.
+func (ws * WsServer) Delivered(ctx context.Context, id string, chat protocol.ChatMessage) (bool, error) {
+
+	if chat.ID == "" {
+		return false, nil
+	}
+
+	cursor, err:= ws.Redis.HGet(ctx, cursorKey(id), chat.Conversation()).Result()
+
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return !StreamIDLess(cursor, chat.ID), nil
+}
+
+// MarkDelivered moves the user's cursor for the message's conversation past
+// it and, for someone else's message, sends its sender a delivered receipt.
+func (ws * WsServer) MarkDelivered(ctx context.Context, id string, chat protocol.ChatMessage) error {
+
+	if chat.ID == "" {
+		return nil
+	}
+
+	if err:= ws.Redis.HSet(ctx, cursorKey(id), chat.Conversation(), chat.ID).Err(); err != nil {
+		return err
+	}
+
+	if chat.From == id {
+		return nil
+	}
+
+	return ws.PublishReceipt(ctx, protocol.ReceiptMessage{
+		ID: chat.ID,
+		State: protocol.ReceiptDelivered,
+		By: id,
+		To: chat.From,
+		Room: chat.Room,
+	})
+}
+
+func historyMessage(entry redis.XMessage) protocol.ChatMessage {
+
+	field:= func(name string) string {
+		value, _:= entry.Values[name].(string)
+		return value
+	}
+
+	color, _:= strconv.Atoi(field("color"))
+	sentAt, _:= strconv.ParseInt(field("sentAt"), 10, 64)
+
+	return protocol.ChatMessage{
+		ID: entry.ID,
+		ClientID: field("clientId"),
+		SentAt: sentAt,
+		From: field("from"),
+		To: field("to"),
+		Room: field("room"),
+		Text: field("text"),
+		Color: color,
+	}
+}
+
+// ReplayHistory sends a new session, conversation by conversation, every
+// message no device has had yet and at least the last replayWindow, the
+// user's own included. Only those past the cursor count as delivered. The
+// last entry id sent per conversation is recorded in seen so live traffic
+// already replayed can be skipped.
+func (ws * WsServer) ReplayHistory(ctx context.Context, id string, seen map[string]string, send func(protocol.MessageWrapper) error) error {
+
+	conversations, err:= ws.Redis.SMembers(ctx, conversationsKey(id)).Result()
+
+	if err != nil {
+		return err
+	}
+
+	for _, conversation:= range conversations{
+
+		// Only a member may read a room, whatever got into the set.
+		if room, ok:= strings.CutPrefix(conversation, protocol.RoomPrefix); ok {
+
+			member, err:= ws.IsMember(ctx, id, room)
+
+			if err != nil {
+				return err
+			}
+
+			if !member {
+				continue
+			}
+		}
+
+		start:= "-"
+
+		cursor, err:= ws.Redis.HGet(ctx, cursorKey(id), conversation).Result()
+
+		delivered:= err == nil
+
+		if delivered {
+			start = "(" + cursor
+		}else if !errors.Is(err, redis.Nil){
+			return err
+		}
+
+		entries, err:= ws.Redis.XRange(ctx, HistoryKey(conversation), start, "+").Result()
+
+		if err != nil {
+			return err
+		}
+
+		// Both are the end of the stream, so the longer one holds the other.
+		if len(entries) < replayWindow {
+
+			entries, err = ws.Redis.XRevRangeN(ctx, HistoryKey(conversation), "+", "-", replayWindow).Result()
+
+			if err != nil {
+				return err
+			}
+
+			slices.Reverse(entries)
+		}
+
+		for _, entry:= range entries{
+
+			chat:= historyMessage(entry)
+
+			raw, err:= json.Marshal(chat)
+
+			if err != nil {
+				return err
+			}
+
+			if err:= send(protocol.MessageWrapper{Type: protocol.TypeChat, Value: raw}); err != nil {
+				return err
+			}
+
+			seen[conversation] = entry.ID
+
+			if delivered && !StreamIDLess(cursor, entry.ID) {
+				continue
+			}
+
+			if err:= ws.MarkDelivered(ctx, id, chat); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
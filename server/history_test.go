@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestStreamIDLess(t * testing.T){
+
+	tests:= [] struct {
+		a string
+		b string
+		less bool
+	}{
+		{"1-0", "2-0", true},
+		{"2-0", "1-0", false},
+		{"1-0", "1-0", false},
+		{"1-1", "1-2", true},
+		{"1-2", "1-1", false},
+		// Compared as numbers, not strings.
+		{"9-0", "10-0", true},
+		{"1-9", "1-10", true},
+		{"1700000000000-5", "1700000000001-0", true},
+		// An id without a sequence is the first of its millisecond.
+		{"5", "5-1", true},
+		{"5-0", "5", false},
+	}
+
+	for _, test:= range tests{
+
+		if less:= StreamIDLess(test.a, test.b); less != test.less {
+			t.Errorf("StreamIDLess(%q, %q) = %v, want %v", test.a, test.b, less, test.less)
+		}
+	}
+}
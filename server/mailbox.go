@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+// mailboxTTL is how long a mailbox is kept after its last message. A user
+// away for longer still gets what history holds when they come back.
+const mailboxTTL = 30 * 24 * time.Hour
+
+func mailboxKey(id string) string {
+	return "mailbox:" + id
+}
+
+// IsActive reports whether id currently has a live connection.
+func (ws * WsServer) IsActive(ctx context.Context, id string) (bool, error) {
+
+	return ws.Redis.SIsMember(ctx, "active:channels", id).Result()
+}
+
+// Hold queues a message for a user who is offline until FlushMailbox runs
+// for them. Like history, a mailbox keeps only the latest HistoryLimit
+// messages.
+func (ws * WsServer) Hold(ctx context.Context, chat protocol.ChatMessage) error {
+
+	raw, err:= json.Marshal(chat)
+
+	if err != nil {
+		return err
+	}
+
+	key:= mailboxKey(chat.To)
+
+	pipe:= ws.Redis.Pipeline()
+	pipe.RPush(ctx, key, raw)
+	pipe.LTrim(ctx, key, -ws.HistoryLimit, -1)
+	pipe.Expire(ctx, key, mailboxTTL)
+
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+// FlushMailbox sends the held messages for id in the order they were queued,
+// marking each one delivered. Messages are only removed from the mailbox once
+// they have been written, so a failed flush is picked up on the next connect.
+func (ws * WsServer) FlushMailbox(ctx context.Context, id string, seen map[string]string, send func(protocol.MessageWrapper) error) error {
+
+	held, err:= ws.Redis.LRange(ctx, mailboxKey(id), 0, -1).Result()
+
+	if err != nil {
+		return err
+	}
+
+	flushed:= 0
+
+	defer func(){
+
+		if flushed == 0 {
+			return
+		}
+
+		if err:= ws.Redis.LTrim(ctx, mailboxKey(id), int64(flushed), -1).Err(); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	for _, raw:= range held{
+
+		chat:= new(protocol.ChatMessage)
+
+		if err:= json.Unmarshal([]byte(raw), chat); err != nil {
+			fmt.Println(err)
+			flushed++
+			continue
+		}
+
+		delivered, err:= ws.Delivered(ctx, id, *chat)
+
+		if err != nil {
+			return err
+		}
+
+		if !delivered {
+
+			if err:= send(protocol.MessageWrapper{Type: protocol.TypeChat, Value: json.RawMessage(raw)}); err != nil {
+				return err
+			}
+
+			if err:= ws.MarkDelivered(ctx, id, *chat); err != nil {
+				return err
+			}
+		}
+
+		// History may already have replayed past it.
+		if last, ok:= seen[chat.Conversation()]; !ok || StreamIDLess(last, chat.ID) {
+			seen[chat.Conversation()] = chat.ID
+		}
+
+		flushed++
+	}
+
+	return nil
+}
@@ -3,43 +3,25 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"slices"
 	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/Ikenna-Okpala/chatty/protocol"
 	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
 )
 
-type MessageWrapper struct{
-	Type string `json:"type"`
-	Value json.RawMessage `json:"value"`
-}
-
-
-type ChatMessage struct {
-	To string `json:"to"`
-	From string `json:"from"`
-	Text string `json:"text"`
-	Color int `json:"color"`
-}
-
-type TypingMessage struct {
-	IsTyping bool `json:"isTyping"`
-	To string `json:"to"`
-	Color int `json:"color"`
-	From string `json:"from"`
-}
-
-type Friend string
-type FriendList [] Friend
-
-
 func FailOnEnv(env string){
 
 	if env == ""{
@@ -83,12 +65,22 @@ func Redis() * redis.Client{
 
 var upgrader = websocket.Upgrader{
 
-	CheckOrigin: func(r *http.Request) bool {return true},
+	CheckOrigin: CheckOrigin,
 
 }
 
 type WsServer struct{
 	Redis *redis.Client
+	HistoryLimit int64
+	Secret [] byte
+	TokenTTL time.Duration
+	DedupeTTL time.Duration
+	MinClientVersion int
+	Policy SessionPolicy
+	conns map[*websocket.Conn] Connection
+	connsMux sync.Mutex
+	handlers sync.WaitGroup
+	draining bool
 }
 
 func (ws * WsServer)Chat(w  http.ResponseWriter, r * http.Request){
@@ -100,106 +92,280 @@ func (ws * WsServer)Chat(w  http.ResponseWriter, r * http.Request){
 		return
 	}
 
+	if ws.Draining() {
+		http.Error(w, "Server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	owner, err:= ws.VerifyToken(RequestToken(r))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if owner != id {
+		http.Error(w, "Token does not belong to "+id, http.StatusForbidden)
+		return
+	}
+
 	conn, err:= upgrader.Upgrade(w, r, nil)
 
 	if err != nil {
 		log.Println(err)
+		return
 	}
 
-	ctx:= context.Background()
-
-	sub:= ws.Redis.Subscribe(ctx, id)
+	defer conn.Close()
 
-	allSub:= ws.Redis.Subscribe(ctx, "all")
+	hello, err:= ws.Handshake(conn)
 
-	_, err2:= allSub.Receive(ctx)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
-	if err2 != nil {
-		fmt.Println(err2)
+	if hello.Version < ws.MinClientVersion {
+		fmt.Println(id, "speaks protocol", hello.Version, "refusing")
+		CloseWith(conn, protocol.CloseUnsupportedVersion, ws.Unsupported(hello))
 		return
 	}
 
-	allCh:= allSub.Channel()
+	ctx:= context.Background()
 
-	go func(){
-		for event:= range allCh{
+	// color is stamped on everything the user sends, whatever the client
+	// claimed, so they look the same to everyone.
+	color, err:= ws.UserColor(ctx, id)
 
-			fmt.Println(id, "joined....")
+	if err != nil {
+		fmt.Println(err)
+	}
 
-			active:= make([] string, 0)
+	var writeMux sync.Mutex
 
-			if err:= json.Unmarshal([]byte(event.Payload), &active); err != nil {
-				fmt.Println(err)
-			}
+	// sent holds the ids of messages this connection sent, so their echoes
+	// are only written to the sender's other devices.
+	var sent sync.Map
 
-			active = slices.DeleteFunc(active, func(ele string) bool {
-				return id == ele
-			})
+	// send drops frames of features the client did not say hello with.
+	send:= func(messageWrapper protocol.MessageWrapper) error {
 
+		if !hello.Accepts(messageWrapper.Type) {
+			return nil
+		}
 
-			raw, err:= json.Marshal(active)
+		writeMux.Lock()
+		defer writeMux.Unlock()
 
-			if err != nil {
-				fmt.Println(err)
-			}
+		return conn.WriteJSON(messageWrapper)
+	}
 
-			messageWrapper:= MessageWrapper{
-				Type: "friends",
-				Value: raw,
-			}
+	if helloFrame, err:= protocol.Wrap(ws.ServerHello()); err != nil {
+		fmt.Println(err)
+	}else if err:= send(helloFrame); err != nil {
+		fmt.Println(err)
+		return
+	}
 
+	session:= NewSessionID()
 
-			// fmt.Println("Friends Update: ", string(msg))
+	claimed, err:= ws.ClaimSession(ctx, id, session)
 
+	if err != nil {
+		fmt.Println(err)
+		CloseWith(conn, websocket.CloseInternalServerErr, "Could not start session")
+		return
+	}
 
-			if err:= conn.WriteJSON(messageWrapper); err!= nil {
-				fmt.Println(err)
+	if !claimed {
+		fmt.Println(id, "is already connected, refusing")
+		CloseWith(conn, protocol.CloseSessionExists, id+" is already connected elsewhere")
+		return
+	}
 
-			}
+	if !ws.Track(conn, Connection{ID: id, Session: session}) {
+
+		if _, err:= ws.ReleaseSession(ctx, id, session); err != nil {
+			fmt.Println(err)
+		}
+
+		CloseWith(conn, websocket.CloseGoingAway, "Server going away")
+		return
+	}
+
+	defer ws.Untrack(conn)
+
+	defer func(){
+
+		// Drain got to it first.
+		if !ws.TakeRelease(conn) {
+			return
+		}
+
+		remaining, err:= ws.ReleaseSession(ctx, id, session)
+
+		if err != nil {
+			fmt.Println(err)
+			return
 		}
+
+		if remaining > 0 {
+			fmt.Println(id, "still has", remaining, "sessions")
+			return
+		}
+
+		fmt.Println(id, "is offline")
 	}()
 
+	if err:= ws.RefreshPresence(ctx, id); err != nil {
+		fmt.Println(err)
+	}
 
-	active, err:= ws.AllActiveUsers()
+	done:= make(chan struct{})
+
+	defer close(done)
+
+	ws.Heartbeat(ctx, id, conn, done)
+
+	rooms, err:= ws.UserRooms(ctx, id)
 
 	if err != nil {
 		fmt.Println(err)
 	}
 
-	active = append(active, id)
+	channels:= [] string{UserChannel(id), roomsUpdates, presenceUpdates, RoomsChannel(id), SessionChannel(id)}
+
+	joined:= make(map[string]bool)
+
+	for _, room:= range rooms{
+		channels = append(channels, RoomChannel(room))
+		joined[room] = true
+	}
 
-	activeEnc, err2:= json.Marshal(active)
+	sub:= ws.Redis.Subscribe(ctx, channels...)
 
-	if err2 != nil {
+	if _, err:= sub.Receive(ctx); err != nil {
 		fmt.Println(err)
+		sub.Close()
+		CloseWith(conn, websocket.CloseInternalServerErr, "Could not subscribe")
+		return
 	}
 
+	ch:= sub.Channel()
 
-	if err:= ws.Redis.Publish(ctx, "all", activeEnc).Err(); err != nil {
+	if err:= ws.Join(ctx, id); err != nil{
 		fmt.Println(err)
 	}
 
+	fmt.Println(id, "is active")
 
-	ch:= sub.Channel()
+	if roomsFrame, err:= ws.RoomsFrame(ctx, id); err != nil {
+		fmt.Println(err)
+	}else if err:= send(roomsFrame); err != nil {
+		fmt.Println(err)
+	}
 
-	if err:= ws.Redis.SAdd(ctx, "active:channels", id).Err(); err != nil{
+	if friendsFrame, err:= ws.FriendsFrame(id); err != nil {
+		fmt.Println(err)
+	}else if err:= send(friendsFrame); err != nil {
 		fmt.Println(err)
 	}
 
-	
+	if snapshot, err:= ws.PresenceSnapshot(ctx, id); err != nil {
+		fmt.Println(err)
+	}else{
 
-	defer conn.Close()
+		for _, presence:= range snapshot{
 
-	fmt.Println(id, "is active")
+			raw, err:= json.Marshal(presence)
+
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+
+			if err:= send(protocol.MessageWrapper{Type: protocol.TypePresence, Value: raw}); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+
+	seen:= make(map[string]string)
+
+	// History first, in order; the mailbox then only adds what history
+	// no longer holds.
+	if err:= ws.ReplayHistory(ctx, id, seen, send); err != nil {
+		fmt.Println(err)
+	}
+
+	if err:= ws.FlushMailbox(ctx, id, seen, send); err != nil {
+		fmt.Println(err)
+	}
+
+	reject:= func(kind string, err error){
+
+		fmt.Println(id, "rejected", kind, err)
+
+		if err:= send(ErrorFrame(kind, "", err)); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	// rejectChat names the chat it rejects, so the client marks that one
+	// as not sent rather than whichever it sent first.
+	rejectChat:= func(clientID string, err error){
+
+		fmt.Println(id, "rejected", protocol.TypeChat, err)
+
+		if err:= send(ErrorFrame(protocol.TypeChat, clientID, err)); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	// throttled remembers until when each frame type is limited, so a client
+	// that keeps sending is told once rather than once per dropped frame.
+	// Chats with a client id are the exception: each is reported, so the
+	// client knows which ones were not sent.
+	throttled:= make(map[string] time.Time)
+
+	throttle:= func(kind string, clientID string, retryAfter time.Duration){
+
+		if clientID == "" && time.Now().Before(throttled[kind]) {
+			return
+		}
+
+		throttled[kind] = time.Now().Add(retryAfter)
+
+		fmt.Println(id, "is rate limited for", kind)
+
+		if err:= send(RateLimitedFrame(kind, clientID, retryAfter)); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	// dropped reports a frame the limits turned away by its type and, for a
+	// chat, its client id, so the client knows which message to send again.
+	// A frame too broken to read is reported without them.
+	dropped:= func(frame * protocol.MessageWrapper, retryAfter time.Duration){
+
+		chat:= protocol.ChatMessage{}
+
+		if frame.Type == protocol.TypeChat {
+			json.Unmarshal(frame.Value, &chat)
+		}
+
+		throttle(frame.Type, chat.ClientID, retryAfter)
+	}
+
+	frames:= NewBucket(FrameLimit)
 
 	go func(){
 
 		defer sub.Close()
-		defer allSub.Close()
 
 		for {
 			
-			messageWraper:= new(MessageWrapper)
+			messageWraper:= new(protocol.MessageWrapper)
 
 			 _, msg, err:= conn.ReadMessage()
 
@@ -218,35 +384,289 @@ func (ws * WsServer)Chat(w  http.ResponseWriter, r * http.Request){
 
 			 
 
+			 // Charged before the frame is even decoded, so junk is as
+			 // limited as anything else. A dropped frame is only decoded to
+			 // say what it was.
+			 if allowed, retryAfter:= frames.Take(); !allowed {
+				json.Unmarshal(msg, messageWraper)
+				dropped(messageWraper, retryAfter)
+				continue
+			 }
+
 			 if err:= json.Unmarshal(msg, messageWraper); err != nil {
+				reject(messageWraper.Type, Reject(protocol.CodeInvalidFrame, "Frame is not valid JSON"))
+				continue
+			 }
+
+			 allowed, retryAfter, err:= ws.Allow(ctx, id, messageWraper.Type)
+
+			 if err != nil {
 				fmt.Println(err)
 			 }
 
-			 chatting:= new(ChatMessage)
-			 typing:= new(TypingMessage)
+			 if !allowed {
+				dropped(messageWraper, retryAfter)
+				continue
+			 }
+
+			 chatting:= new(protocol.ChatMessage)
+			 typing:= new(protocol.TypingMessage)
 
 			 switch messageWraper.Type {
 
-			 case "chat":
+			 case protocol.TypeChat:
 
 				if err:= json.Unmarshal(messageWraper.Value, chatting); err != nil{
+					reject(messageWraper.Type, Reject(protocol.CodeInvalidFrame, "Chat message is malformed"))
+					break
+				}
+
+				if err:= ValidateChat(id, chatting); err != nil {
+					rejectChat(chatting.ClientID, err)
+					break
+				}
+
+				if color != 0 {
+					chatting.Color = color
+				}
+
+				if chatting.Room != "" {
+
+					member, err:= ws.IsMember(ctx, id, chatting.Room)
+
+					if err != nil {
+						rejectChat(chatting.ClientID, err)
+						break
+					}
+
+					if !member {
+						rejectChat(chatting.ClientID, ErrNotMember)
+						break
+					}
+				}else{
+
+					known, err:= ws.IsUser(ctx, chatting.To)
+
+					if err != nil {
+						rejectChat(chatting.ClientID, err)
+						break
+					}
+
+					if !known {
+						rejectChat(chatting.ClientID, ErrUnknownUser)
+						break
+					}
+				}
+
+				if chatting.ClientID != "" {
+
+					fresh, stored, err:= ws.ClaimMessage(ctx, id, chatting.ClientID)
+
+					if err != nil {
+						rejectChat(chatting.ClientID, err)
+						break
+					}
+
+					// A resend of a message we already have: ack it again, once
+					// the first copy has an id, and drop it.
+					if !fresh {
+
+						if stored == ""{
+							break
+						}
+
+						if ack, err:= AckFrame(stored, chatting.ClientID); err != nil {
+							fmt.Println(err)
+						}else if err:= send(ack); err != nil {
+							fmt.Println(err)
+						}
+						break
+					}
+				}
+
+				if err:= ws.AppendHistory(ctx, chatting); err != nil {
+
+					if chatting.ClientID != "" {
+						if err:= ws.ReleaseMessage(ctx, id, chatting.ClientID); err != nil {
+							fmt.Println(err)
+						}
+					}
+
+					rejectChat(chatting.ClientID, err)
+					break
+				}
+
+				if chatting.ClientID != "" {
+					if err:= ws.StoreMessageID(ctx, id, chatting.ClientID, chatting.ID); err != nil {
+						fmt.Println(err)
+					}
+				}
+
+				raw, err:= json.Marshal(chatting)
+
+				if err != nil {
+					fmt.Println(err)
+					break
+				}
+
+				stored, err:= json.Marshal(protocol.MessageWrapper{Type: protocol.TypeChat, Value: raw})
+
+				if err != nil {
+					fmt.Println(err)
+					break
+				}
+
+				sent.Store(chatting.ID, true)
+
+				if ack, err:= AckFrame(chatting.ID, chatting.ClientID); err != nil {
+					fmt.Println(err)
+				}else if err:= send(ack); err != nil {
+					fmt.Println(err)
+				}
+
+				if chatting.Room != "" {
+
+					if err:= ws.Redis.Publish(ctx, RoomChannel(chatting.Room), string(stored)).Err(); err != nil {
+						fmt.Println(err)
+					}
+					break
+				}
+
+				// Echo to the sender's other devices so their conversation stays in sync.
+				if err:= ws.Redis.Publish(ctx, UserChannel(id), string(stored)).Err(); err != nil {
 					fmt.Println(err)
 				}
 
-				if err:= ws.Redis.Publish(ctx, chatting.To, string(msg)).Err(); err != nil {
+				online, err:= ws.IsActive(ctx, chatting.To)
+
+				if err != nil {
+					fmt.Println(err)
+				}
+
+				if !online {
+
+					if err:= ws.Hold(ctx, *chatting); err != nil {
+						fmt.Println(err)
+					}
+					break
+				}
+
+				if err:= ws.Redis.Publish(ctx, UserChannel(chatting.To), string(stored)).Err(); err != nil {
 					fmt.Println(err)
 					break
 				}
 
-			case "typing":
+			case protocol.TypeTyping:
 				if err:= json.Unmarshal(messageWraper.Value, typing); err != nil{
+					reject(messageWraper.Type, Reject(protocol.CodeInvalidFrame, "Typing event is malformed"))
+					break
+				}
+
+				if err:= ValidateTyping(id, typing); err != nil {
+					reject(messageWraper.Type, err)
+					break
+				}
+
+				if typing.Room != "" {
+
+					member, err:= ws.IsMember(ctx, id, typing.Room)
+
+					if err != nil {
+						reject(messageWraper.Type, err)
+						break
+					}
+
+					if !member {
+						reject(messageWraper.Type, ErrNotMember)
+						break
+					}
+				}
+
+				if color != 0 {
+					typing.Color = color
+				}
+
+				raw, err:= json.Marshal(typing)
+
+				if err != nil {
+					fmt.Println(err)
+					break
+				}
+
+				stamped, err:= json.Marshal(protocol.MessageWrapper{Type: protocol.TypeTyping, Value: raw})
+
+				if err != nil {
 					fmt.Println(err)
+					break
+				}
+
+				channel:= UserChannel(typing.To)
+
+				if typing.Room != "" {
+					channel = RoomChannel(typing.Room)
+				}
+
+				if err:= ws.Redis.Publish(ctx, channel, string(stamped)).Err(); err != nil {
+					fmt.Println(err)
+					break
+				}
+
+			case protocol.TypePresence:
+				presence:= new(protocol.PresenceMessage)
+
+				if err:= json.Unmarshal(messageWraper.Value, presence); err != nil{
+					reject(messageWraper.Type, Reject(protocol.CodeInvalidFrame, "Presence update is malformed"))
+					break
+				}
+
+				if presence.State != protocol.StateOnline && presence.State != protocol.StateAway {
+					reject(messageWraper.Type, Reject(protocol.CodeInvalidFrame, "Presence state must be online or away"))
+					break
+				}
+
+				if err:= ws.SetState(ctx, id, presence.State); err != nil {
+					fmt.Println(err)
+				}
+
+			case protocol.TypeReceipt:
+				receipt:= new(protocol.ReceiptMessage)
+
+				if err:= json.Unmarshal(messageWraper.Value, receipt); err != nil{
+					reject(messageWraper.Type, Reject(protocol.CodeInvalidFrame, "Receipt is malformed"))
+					break
 				}
 
-				if err:= ws.Redis.Publish(ctx, typing.To, string(msg)).Err(); err != nil {
+				if err:= ValidateReceipt(id, receipt); err != nil {
+					reject(messageWraper.Type, err)
+					break
+				}
+
+				if err:= ws.CheckReceipt(ctx, id, *receipt); err != nil {
+					reject(messageWraper.Type, err)
+					break
+				}
+
+				if err:= ws.PublishReceipt(ctx, *receipt); err != nil {
 					fmt.Println(err)
+				}
+
+			case protocol.TypeRoom:
+				room:= new(protocol.RoomMessage)
+
+				if err:= json.Unmarshal(messageWraper.Value, room); err != nil{
+					reject(messageWraper.Type, Reject(protocol.CodeInvalidFrame, "Room request is malformed"))
 					break
 				}
+
+				if err:= ws.HandleRoom(ctx, id, *room); err != nil {
+					reject(messageWraper.Type, err)
+				}
+
+			case protocol.TypeHello:
+				reject(messageWraper.Type, Reject(protocol.CodeInvalidFrame, "Hello was already received"))
+
+			default:
+				reject(messageWraper.Type, Reject(protocol.CodeUnsupported, "Unsupported message type: " + messageWraper.Type))
 			 }
 		}
 	}()
@@ -254,15 +674,122 @@ func (ws * WsServer)Chat(w  http.ResponseWriter, r * http.Request){
 
 	for incoming:= range ch {
 
+		if incoming.Channel == SessionChannel(id) {
+
+			if incoming.Payload == session {
+				continue
+			}
+
+			fmt.Println(id, "was taken over by another session")
+			CloseWith(conn, protocol.CloseSessionReplaced, "Signed in from another location")
+			break
+		}
+
+		if incoming.Channel == presenceUpdates {
+
+			presence:= new(protocol.PresenceMessage)
+
+			if err:= json.Unmarshal([]byte(incoming.Payload), presence); err != nil {
+				fmt.Println(err)
+				continue
+			}
+
+			if presence.User == id {
+				continue
+			}
+
+			if err:= send(protocol.MessageWrapper{Type: protocol.TypePresence, Value: json.RawMessage(incoming.Payload)}); err != nil {
+				fmt.Println(err)
+				break
+			}
+
+			continue
+		}
+
+		if incoming.Channel == RoomsChannel(id) {
+
+			if err:= ws.SyncRooms(ctx, id, sub, joined); err != nil {
+				fmt.Println(err)
+			}
+		}
+
+		if incoming.Channel == roomsUpdates || incoming.Channel == RoomsChannel(id) {
+
+			roomsFrame, err:= ws.RoomsFrame(ctx, id)
+
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+
+			if err:= send(roomsFrame); err != nil {
+				fmt.Println(err)
+				break
+			}
+
+			continue
+		}
+
+		messageWrapper:= new(protocol.MessageWrapper)
+
+		if err:= json.Unmarshal([]byte(incoming.Payload), messageWrapper); err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		if !hello.Accepts(messageWrapper.Type) {
+			continue
+		}
+
+		chatting:= new(protocol.ChatMessage)
+
+		if messageWrapper.Type == protocol.TypeTyping {
+
+			typing:= new(protocol.TypingMessage)
+
+			if err:= json.Unmarshal(messageWrapper.Value, typing); err == nil && typing.From == id {
+				continue
+			}
+		}
+
+		if messageWrapper.Type == protocol.TypeChat {
+
+			if err:= json.Unmarshal(messageWrapper.Value, chatting); err != nil {
+				fmt.Println(err)
+				continue
+			}
+
+			if chatting.From == id {
+
+				if _, mine:= sent.LoadAndDelete(chatting.ID); mine || chatting.ID == "" {
+					continue
+				}
+			}
+
+			last, replayed:= seen[chatting.Conversation()]
+
+			if replayed && chatting.ID != "" && !StreamIDLess(last, chatting.ID) {
+				continue
+			}
+		}
+
 		fmt.Println("Sending chat: ", incoming.Payload)
-		if err:= conn.WriteMessage(websocket.TextMessage, []byte(incoming.Payload)); err != nil {
+
+		writeMux.Lock()
+		err:= conn.WriteMessage(websocket.TextMessage, []byte(incoming.Payload))
+		writeMux.Unlock()
+
+		if err != nil {
 			fmt.Println(err)
 				break
 		}
-	}
 
-	if err:= ws.Redis.SRem(ctx, "active:channels", id).Err(); err != nil {
-		fmt.Println(err)
+		if messageWrapper.Type == protocol.TypeChat && chatting.ID != "" {
+
+			if err:= ws.MarkDelivered(ctx, id, *chatting); err != nil {
+				fmt.Println(err)
+			}
+		}
 	}
 
 }
@@ -285,6 +812,23 @@ func (ws * WsServer) AllActiveUsers() ([] string, error){
 	return online, nil
 }
 
+// FriendsFrame wraps everyone connected except id, the snapshot a new
+// connection starts from before presence deltas arrive.
+func (ws * WsServer) FriendsFrame(id string) (protocol.MessageWrapper, error) {
+
+	active, err:= ws.AllActiveUsers()
+
+	if err != nil {
+		return protocol.MessageWrapper{}, err
+	}
+
+	active = slices.DeleteFunc(active, func(ele string) bool {
+		return id == ele
+	})
+
+	return protocol.Wrap(protocol.FriendList(active))
+}
+
 func (ws * WsServer) Health(w http.ResponseWriter, r * http.Request){
 
 	w.WriteHeader(http.StatusOK)
@@ -303,13 +847,53 @@ func main() {
 		fmt.Println(err)
 	}
 
+	ctx, stop:= signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+
+	defer stop()
+
 	server:= WsServer{
 		Redis: Redis(),
+		HistoryLimit: HistoryLimit(),
+		Secret: TokenSecret(),
+		TokenTTL: TokenTTL(),
+		DedupeTTL: DedupeTTL(),
+		MinClientVersion: MinClientVersion(),
+		Policy: Policy(),
 	}
 
 	http.HandleFunc("/chat/{id}", server.Chat)
 	http.HandleFunc("/health", server.Health)
+	http.HandleFunc("/register", server.Register)
+	http.HandleFunc("/login", server.Login)
+
+
+	go server.Sweeper(ctx)
+
+	httpServer:= &http.Server{Addr: ":8080"}
 
+	go func(){
+
+		if err:= httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println(err)
+			stop()
+		}
+	}()
 
-	http.ListenAndServe(":8080", nil)
+	<- ctx.Done()
+
+	fmt.Println("Shutting down...")
+
+	shutdownCtx, cancel:= context.WithTimeout(context.Background(), ShutdownTimeout())
+
+	defer cancel()
+
+	if err:= httpServer.Shutdown(shutdownCtx); err != nil {
+		fmt.Println(err)
+	}
+
+	server.Drain(shutdownCtx)
+
+	if err:= server.Redis.Close(); err != nil {
+		fmt.Println(err)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// pongWait is how long a connection may stay silent before it is dropped.
+	pongWait = 60 * time.Second
+	// pingPeriod must be shorter than pongWait so a healthy client always answers in time.
+	pingPeriod = (pongWait * 9) / 10
+	writeWait = 10 * time.Second
+	// presenceTTL outlives a couple of missed pings before a user is swept.
+	presenceTTL = 2 * pongWait
+	sweepInterval = 30 * time.Second
+)
+
+// presenceUpdates is the channel every connection hears presence changes on.
+const presenceUpdates = "presence"
+
+func presenceKey(id string) string {
+	return "presence:" + id
+}
+
+// presenceStatesKey maps each connected user to online or away.
+const presenceStatesKey = "presence:states"
+
+// lastSeenKey maps every user to the unix time they were last heard from.
+const lastSeenKey = "presence:lastseen"
+
+// RefreshPresence marks id as alive for another presenceTTL.
+func (ws * WsServer) RefreshPresence(ctx context.Context, id string) error {
+
+	now:= time.Now().Unix()
+
+	pipe:= ws.Redis.Pipeline()
+	pipe.Set(ctx, presenceKey(id), now, presenceTTL)
+	pipe.HSet(ctx, lastSeenKey, id, now)
+
+	_, err:= pipe.Exec(ctx)
+
+	return err
+}
+
+// presencePayload announces id's state, in their colour.
+func (ws * WsServer) presencePayload(ctx context.Context, id string, state string, lastSeen int64) (string, error) {
+
+	color, err:= ws.UserColor(ctx, id)
+
+	if err != nil {
+		return "", err
+	}
+
+	raw, err:= json.Marshal(protocol.PresenceMessage{
+		User: id,
+		State: state,
+		LastSeen: lastSeen,
+		Color: color,
+	})
+
+	return string(raw), err
+}
+
+// joinUser adds the user to the active set and announces them in one step,
+// so no connection can observe one without the other.
+var joinUser = redis.NewScript(`
+redis.call("SADD", KEYS[1], ARGV[1])
+redis.call("HSET", KEYS[2], ARGV[1], "online")
+redis.call("PUBLISH", ARGV[3], ARGV[2])
+return 1
+`)
+
+// setState changes the state of a user who is still active and announces it.
+var setState = redis.NewScript(`
+if redis.call("SISMEMBER", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[2], ARGV[1], ARGV[2])
+redis.call("PUBLISH", ARGV[4], ARGV[3])
+return 1
+`)
+
+// Join marks id as online and publishes the delta to every connection.
+func (ws * WsServer) Join(ctx context.Context, id string) error {
+
+	payload, err:= ws.presencePayload(ctx, id, protocol.StateOnline, 0)
+
+	if err != nil {
+		return err
+	}
+
+	keys:= [] string{"active:channels", presenceStatesKey}
+
+	return joinUser.Run(ctx, ws.Redis, keys, id, payload, presenceUpdates).Err()
+}
+
+// SetState switches a connected user between online and away.
+func (ws * WsServer) SetState(ctx context.Context, id string, state string) error {
+
+	payload, err:= ws.presencePayload(ctx, id, state, 0)
+
+	if err != nil {
+		return err
+	}
+
+	keys:= [] string{"active:channels", presenceStatesKey}
+
+	return setState.Run(ctx, ws.Redis, keys, id, state, payload, presenceUpdates).Err()
+}
+
+// PresenceSnapshot describes everyone id may care about when they connect:
+// each connected user, and the people id has talked to who are offline.
+func (ws * WsServer) PresenceSnapshot(ctx context.Context, id string) ([] protocol.PresenceMessage, error) {
+
+	snapshot:= make([] protocol.PresenceMessage, 0)
+
+	states, err:= ws.Redis.HGetAll(ctx, presenceStatesKey).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	active, err:= ws.AllActiveUsers()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user:= range active{
+
+		if user == id {
+			continue
+		}
+
+		state, ok:= states[user]
+
+		if !ok {
+			state = protocol.StateOnline
+		}
+
+		color, err:= ws.UserColor(ctx, user)
+
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot = append(snapshot, protocol.PresenceMessage{User: user, State: state, Color: color})
+	}
+
+	conversations, err:= ws.Redis.SMembers(ctx, conversationsKey(id)).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, conversation:= range conversations{
+
+		pair, ok:= strings.CutPrefix(conversation, protocol.DMPrefix)
+
+		if !ok {
+			continue
+		}
+
+		a, b, ok:= strings.Cut(pair, ":")
+
+		if !ok {
+			continue
+		}
+
+		peer:= a
+
+		if peer == id {
+			peer = b
+		}
+
+		if peer == id || slices.Contains(active, peer) {
+			continue
+		}
+
+		lastSeen, err:= ws.Redis.HGet(ctx, lastSeenKey, peer).Int64()
+
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+
+		color, err:= ws.UserColor(ctx, peer)
+
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot = append(snapshot, protocol.PresenceMessage{User: peer, State: protocol.StateOffline, LastSeen: lastSeen, Color: color})
+	}
+
+	return snapshot, nil
+}
+
+// Heartbeat pings the connection every pingPeriod until done is closed.
+// Each pong extends the read deadline and refreshes the user's presence.
+func (ws * WsServer) Heartbeat(ctx context.Context, id string, conn * websocket.Conn, done <- chan struct{}){
+
+	if err:= conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
+		fmt.Println(err)
+	}
+
+	conn.SetPongHandler(func(string) error {
+
+		if err:= ws.RefreshPresence(ctx, id); err != nil {
+			fmt.Println(err)
+		}
+
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	ticker:= time.NewTicker(pingPeriod)
+
+	go func(){
+
+		defer ticker.Stop()
+
+		for {
+			select {
+
+			case <- ticker.C:
+				if err:= conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+					fmt.Println(id, "missed ping:", err)
+					return
+				}
+
+			case <- done:
+				return
+			}
+		}
+	}()
+}
+
+// sweepUser drops the user from the active set unless they came back
+// since the sweeper looked, announcing them offline in the same step.
+var sweepUser = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+if redis.call("SREM", KEYS[2], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("DEL", KEYS[3])
+redis.call("HDEL", KEYS[4], ARGV[1])
+redis.call("PUBLISH", ARGV[3], ARGV[2])
+return 1
+`)
+
+// Sweep removes users whose presence expired without a clean disconnect,
+// e.g. because the server holding their socket crashed, and announces
+// each of them as offline.
+func (ws * WsServer) Sweep(ctx context.Context) error {
+
+	active, err:= ws.AllActiveUsers()
+
+	if err != nil {
+		return err
+	}
+
+	expired:= make([] string, 0)
+
+	for _, id:= range active{
+
+		alive, err:= ws.Redis.Exists(ctx, presenceKey(id)).Result()
+
+		if err != nil {
+			return err
+		}
+
+		if alive == 0 {
+			expired = append(expired, id)
+		}
+	}
+
+	if len(expired) == 0 {
+		return nil
+	}
+
+	for _, id:= range expired{
+
+		lastSeen, err:= ws.Redis.HGet(ctx, lastSeenKey, id).Int64()
+
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+
+		payload, err:= ws.presencePayload(ctx, id, protocol.StateOffline, lastSeen)
+
+		if err != nil {
+			return err
+		}
+
+		keys:= [] string{presenceKey(id), "active:channels", sessionsKey(id), presenceStatesKey}
+
+		removed, err:= sweepUser.Run(ctx, ws.Redis, keys, id, payload, presenceUpdates).Int()
+
+		if err != nil {
+			return err
+		}
+
+		if removed == 1 {
+			fmt.Println(id, "expired")
+		}
+	}
+
+	return nil
+}
+
+// Sweeper runs Sweep every sweepInterval until ctx is cancelled.
+func (ws * WsServer) Sweeper(ctx context.Context){
+
+	ticker:= time.NewTicker(sweepInterval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <- ticker.C:
+			if err:= ws.Sweep(ctx); err != nil {
+				fmt.Println(err)
+			}
+
+		case <- ctx.Done():
+			return
+		}
+	}
+}
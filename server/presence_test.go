@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+	"github.com/redis/go-redis/v9"
+)
+
+// testServer connects to the Redis at REDIS_ADDR, logging in with
+// REDIS_USERNAME and REDIS_PASSWORD if they are set, and skips the test
+// when there is none.
+func testServer(t * testing.T) * WsServer {
+
+	t.Helper()
+
+	addr:= os.Getenv("REDIS_ADDR")
+
+	if addr == ""{
+		t.Skip("REDIS_ADDR is not set")
+	}
+
+	client:= redis.NewClient(&redis.Options{
+		Addr: addr,
+		Username: os.Getenv("REDIS_USERNAME"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+	})
+
+	t.Cleanup(func(){ client.Close() })
+
+	if err:= client.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("Redis at %s: %v", addr, err)
+	}
+
+	return &WsServer{
+		Redis: client,
+		HistoryLimit: defaultHistoryLimit,
+		Policy: PolicyMulti,
+	}
+}
+
+// TestPresenceConcurrent connects several devices per user at once, then
+// disconnects them all at once. Every user must be active in between and
+// gone after, and be announced offline exactly once, by its last device.
+func TestPresenceConcurrent(t * testing.T){
+
+	ws:= testServer(t)
+	ctx:= context.Background()
+
+	const users = 20
+	const devices = 3
+
+	ids:= make([] string, users)
+
+	for i:= range ids{
+		ids[i] = fmt.Sprintf("presence-test-%s-%d", NewSessionID()[:8], i)
+	}
+
+	t.Cleanup(func(){
+
+		for _, id:= range ids{
+			ws.Redis.Del(ctx, userKey(id), sessionsKey(id), presenceKey(id))
+			ws.Redis.HDel(ctx, lastSeenKey, id)
+			ws.Redis.HDel(ctx, presenceStatesKey, id)
+			ws.Redis.SRem(ctx, "active:channels", id)
+		}
+	})
+
+	sub:= ws.Redis.Subscribe(ctx, presenceUpdates)
+
+	defer sub.Close()
+
+	if _, err:= sub.Receive(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	deltas:= sub.Channel()
+
+	sessions:= make(map[string] [] string)
+
+	for _, id:= range ids{
+		for range devices{
+			sessions[id] = append(sessions[id], NewSessionID())
+		}
+	}
+
+	// all runs step for every session at once, and fails on the first error.
+	all:= func(step func(id string, session string) error){
+
+		var wg sync.WaitGroup
+
+		errs:= make(chan error, users * devices)
+
+		for id, held:= range sessions{
+			for _, session:= range held{
+
+				wg.Add(1)
+
+				go func(){
+					defer wg.Done()
+					errs <- step(id, session)
+				}()
+			}
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err:= range errs{
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	all(func(id string, session string) error {
+
+		claimed, err:= ws.ClaimSession(ctx, id, session)
+
+		if err != nil {
+			return err
+		}
+
+		if !claimed {
+			return fmt.Errorf("%s was refused a session", id)
+		}
+
+		return ws.Join(ctx, id)
+	})
+
+	for _, id:= range ids{
+
+		active, err:= ws.IsActive(ctx, id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !active {
+			t.Errorf("%s is not active after connecting", id)
+		}
+	}
+
+	all(func(id string, session string) error {
+		_, err:= ws.ReleaseSession(ctx, id, session)
+		return err
+	})
+
+	for _, id:= range ids{
+
+		active, err:= ws.IsActive(ctx, id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if active {
+			t.Errorf("%s is still active after every device left", id)
+		}
+	}
+
+	online:= make(map[string] int)
+	offline:= make(map[string] int)
+	last:= make(map[string] string)
+
+	// Every delta is published before the last release returns, but may
+	// still be on its way to us.
+	timeout:= time.After(2 * time.Second)
+
+	for len(offline) < users {
+
+		select {
+
+		case msg:= <- deltas:
+
+			presence:= protocol.PresenceMessage{}
+
+			if err:= json.Unmarshal([]byte(msg.Payload), &presence); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ours:= sessions[presence.User]; !ours {
+				continue
+			}
+
+			last[presence.User] = presence.State
+
+			switch presence.State {
+			case protocol.StateOnline:
+				online[presence.User]++
+			case protocol.StateOffline:
+				offline[presence.User]++
+			}
+
+		case <- timeout:
+			t.Fatalf("only %d of %d users were announced offline", len(offline), users)
+		}
+	}
+
+	// Let any stray duplicate arrive before counting.
+	drain:= time.After(200 * time.Millisecond)
+
+	for waiting:= true; waiting; {
+
+		select {
+
+		case msg:= <- deltas:
+
+			presence:= protocol.PresenceMessage{}
+
+			if err:= json.Unmarshal([]byte(msg.Payload), &presence); err == nil && presence.State == protocol.StateOffline {
+				offline[presence.User]++
+			}
+
+		case <- drain:
+			waiting = false
+		}
+	}
+
+	for _, id:= range ids{
+
+		if online[id] != devices {
+			t.Errorf("%s was announced online %d times, want %d", id, online[id], devices)
+		}
+
+		if offline[id] != 1 {
+			t.Errorf("%s was announced offline %d times, want 1", id, offline[id])
+		}
+
+		if last[id] != protocol.StateOffline {
+			t.Errorf("%s was last announced %s, want offline", id, last[id])
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+	"github.com/redis/go-redis/v9"
+)
+
+// Limit is a token bucket: Burst frames at once, refilled at Rate per second.
+type Limit struct {
+	Rate float64
+	Burst int
+}
+
+// Limits are per user and per message type, so a flood of typing events
+// cannot use up the budget for chat messages. Types without a limit are
+// only held to FrameLimit.
+var Limits = map[string] Limit{
+	protocol.TypeChat: {Rate: 1, Burst: 5},
+	protocol.TypeTyping: {Rate: 2, Burst: 5},
+	protocol.TypeRoom: {Rate: 0.5, Burst: 3},
+	protocol.TypePresence: {Rate: 0.2, Burst: 3},
+	protocol.TypeReceipt: {Rate: 5, Burst: 20},
+}
+
+// FrameLimit caps every frame a connection sends, whatever its type and
+// even if it cannot be read, so malformed or unknown frames cannot make
+// the server write error after error. It sits above the per-type limits.
+var FrameLimit = Limit{Rate: 20, Burst: 60}
+
+// Bucket is a token bucket kept by one connection, for limits that need no
+// agreement between servers.
+type Bucket struct {
+	Limit Limit
+	tokens float64
+	last time.Time
+}
+
+func NewBucket(limit Limit) * Bucket {
+
+	return &Bucket{
+		Limit: limit,
+		tokens: float64(limit.Burst),
+		last: time.Now(),
+	}
+}
+
+// Take spends a token if there is one, or says how long until there is.
+func (b * Bucket) Take() (bool, time.Duration) {
+
+	now:= time.Now()
+
+	b.tokens = min(float64(b.Limit.Burst), b.tokens + now.Sub(b.last).Seconds() * b.Limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / b.Limit.Rate * float64(time.Second))
+}
+
+func rateLimitKey(id string, kind string) string {
+	return "ratelimit:" + id + ":" + kind
+}
+
+// takeToken refills the bucket for the time elapsed on the Redis clock,
+// so every server instance agrees, then spends one token if there is one.
+// It returns whether the frame is allowed and, if not, the wait in ms.
+var takeToken = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local clock = redis.call("TIME")
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1]) or burst
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, retry}
+`)
+
+// Allow spends a token from id's bucket for the frame type.
+func (ws * WsServer) Allow(ctx context.Context, id string, kind string) (bool, time.Duration, error) {
+
+	limit, ok:= Limits[kind]
+
+	if !ok {
+		return true, 0, nil
+	}
+
+	return ws.Take(ctx, rateLimitKey(id, kind), limit)
+}
+
+// Take spends a token from the bucket at key, shared by every server.
+func (ws * WsServer) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+
+	result, err:= takeToken.Run(ctx, ws.Redis, [] string{key}, limit.Rate, limit.Burst).Int64Slice()
+
+	if err != nil {
+		return true, 0, err
+	}
+
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
+
+func RateLimitedFrame(kind string, clientID string, retryAfter time.Duration) protocol.MessageWrapper {
+
+	frame, err:= protocol.Wrap(protocol.RateLimitedMessage{
+		Type: kind,
+		ClientID: clientID,
+		RetryAfter: retryAfter.Milliseconds(),
+	})
+
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	return frame
+}
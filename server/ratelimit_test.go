@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketTake(t * testing.T){
+
+	bucket:= NewBucket(Limit{Rate: 10, Burst: 3})
+
+	for i:= range 3 {
+
+		if allowed, _:= bucket.Take(); !allowed {
+			t.Fatalf("frame %d of the burst was refused", i + 1)
+		}
+	}
+
+	allowed, retryAfter:= bucket.Take()
+
+	if allowed {
+		t.Fatal("a frame past the burst was allowed")
+	}
+
+	if retryAfter <= 0 || retryAfter > 100 * time.Millisecond {
+		t.Errorf("retryAfter = %s, want at most one token's 100ms", retryAfter)
+	}
+
+	// Half a token has come back.
+	bucket.last = bucket.last.Add(-50 * time.Millisecond)
+
+	allowed, retryAfter = bucket.Take()
+
+	if allowed {
+		t.Fatal("a frame was allowed on half a token")
+	}
+
+	if retryAfter <= 0 || retryAfter > 50 * time.Millisecond {
+		t.Errorf("retryAfter = %s, want at most the 50ms left", retryAfter)
+	}
+
+	// A long wait refills no more than the burst.
+	bucket.last = bucket.last.Add(-time.Hour)
+
+	for i:= range 3 {
+
+		if allowed, _:= bucket.Take(); !allowed {
+			t.Fatalf("frame %d after refilling was refused", i + 1)
+		}
+	}
+
+	if allowed, _:= bucket.Take(); allowed {
+		t.Error("the bucket refilled past its burst")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+var streamID = regexp.MustCompile(`^[0-9]{1,20}-[0-9]{1,20}$`)
+
+var ErrNoMessage = Reject(protocol.CodeInvalidFrame, "No such message")
+
+func AckFrame(id string, clientID string) (protocol.MessageWrapper, error) {
+	return protocol.Wrap(protocol.AckMessage{ID: id, ClientID: clientID})
+}
+
+// PublishReceipt routes a receipt to every device of the message's sender.
+func (ws * WsServer) PublishReceipt(ctx context.Context, receipt protocol.ReceiptMessage) error {
+
+	frame, err:= protocol.Encode(receipt)
+
+	if err != nil {
+		return err
+	}
+
+	return ws.Redis.Publish(ctx, UserChannel(receipt.To), frame).Err()
+}
+
+// ValidateReceipt checks a read receipt from id and stamps it with id as
+// the reader. Delivered receipts are only ever produced by the server.
+func ValidateReceipt(id string, receipt * protocol.ReceiptMessage) error {
+
+	receipt.By = id
+
+	if receipt.State != protocol.ReceiptRead {
+		return Reject(protocol.CodeInvalidFrame, "Clients can only send read receipts")
+	}
+
+	if receipt.ID == "" || receipt.To == ""{
+		return Reject(protocol.CodeInvalidFrame, "Receipt needs a message id and its sender")
+	}
+
+	if receipt.To == id {
+		return Reject(protocol.CodeInvalidFrame, "Cannot send a receipt to yourself")
+	}
+
+	if !username.MatchString(receipt.To) {
+		return ErrRecipient
+	}
+
+	if receipt.Room != "" && !roomName.MatchString(receipt.Room) {
+		return ErrRoomName
+	}
+
+	if !streamID.MatchString(receipt.ID) {
+		return ErrNoMessage
+	}
+
+	return nil
+}
+
+// CheckReceipt makes sure a receipt from id is for a message receipt.To
+// really sent to id, or to a room id is in, so nobody can mark messages
+// they never got as read.
+func (ws * WsServer) CheckReceipt(ctx context.Context, id string, receipt protocol.ReceiptMessage) error {
+
+	if receipt.Room != "" {
+
+		member, err:= ws.IsMember(ctx, id, receipt.Room)
+
+		if err != nil {
+			return err
+		}
+
+		if !member {
+			return ErrNotMember
+		}
+	}
+
+	conversation:= protocol.ChatMessage{From: receipt.To, To: id, Room: receipt.Room}.Conversation()
+
+	entries, err:= ws.Redis.XRange(ctx, HistoryKey(conversation), receipt.ID, receipt.ID).Result()
+
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 || historyMessage(entries[0]).From != receipt.To {
+		return ErrNoMessage
+	}
+
+	return nil
+}
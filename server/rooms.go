@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+	"github.com/redis/go-redis/v9"
+)
+
+const roomsUpdates = "rooms"
+
+var roomName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+var ErrRoomName = Reject(protocol.CodeRoom, "Room names are 1-32 letters, digits, '-' or '_'")
+
+var ErrNoRoom = Reject(protocol.CodeRoom, "No such room")
+
+var ErrNotMember = Reject(protocol.CodeNotMember, "You are not a member of this room")
+
+func RoomChannel(name string) string {
+	return "room:" + name
+}
+
+func roomMembersKey(name string) string {
+	return "room:members:" + name
+}
+
+func userRoomsKey(id string) string {
+	return "user:rooms:" + id
+}
+
+// CreateRoom registers a new room and makes its creator the first member.
+// Creating a room that already exists simply joins it.
+func (ws * WsServer) CreateRoom(ctx context.Context, id string, name string) error {
+
+	if !roomName.MatchString(name) {
+		return ErrRoomName
+	}
+
+	added, err:= ws.Redis.SAdd(ctx, "rooms", name).Result()
+
+	if err != nil {
+		return err
+	}
+
+	if err:= ws.JoinRoom(ctx, id, name); err != nil {
+		return err
+	}
+
+	if added == 0 {
+		return nil
+	}
+
+	return ws.Redis.Publish(ctx, roomsUpdates, name).Err()
+}
+
+func (ws * WsServer) JoinRoom(ctx context.Context, id string, name string) error {
+
+	exists, err:= ws.Redis.SIsMember(ctx, "rooms", name).Result()
+
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrNoRoom
+	}
+
+	pipe:= ws.Redis.TxPipeline()
+	pipe.SAdd(ctx, roomMembersKey(name), id)
+	pipe.SAdd(ctx, userRoomsKey(id), name)
+	pipe.SAdd(ctx, conversationsKey(id), protocol.RoomConversation(name))
+
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+func (ws * WsServer) LeaveRoom(ctx context.Context, id string, name string) error {
+
+	pipe:= ws.Redis.TxPipeline()
+	pipe.SRem(ctx, roomMembersKey(name), id)
+	pipe.SRem(ctx, userRoomsKey(id), name)
+	pipe.SRem(ctx, conversationsKey(id), protocol.RoomConversation(name))
+
+	_, err:= pipe.Exec(ctx)
+
+	return err
+}
+
+func (ws * WsServer) IsMember(ctx context.Context, id string, name string) (bool, error) {
+
+	return ws.Redis.SIsMember(ctx, roomMembersKey(name), id).Result()
+}
+
+// UserRooms lists the rooms id belongs to.
+func (ws * WsServer) UserRooms(ctx context.Context, id string) ([] string, error) {
+
+	rooms, err:= ws.Redis.SMembers(ctx, userRoomsKey(id)).Result()
+
+	if errors.Is(err, redis.Nil) {
+		return [] string{}, nil
+	}
+
+	return rooms, err
+}
+
+// ListRooms returns every room, sorted by name, marking the ones id has joined.
+func (ws * WsServer) ListRooms(ctx context.Context, id string) (protocol.RoomList, error) {
+
+	all, err:= ws.Redis.SMembers(ctx, "rooms").Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	joined, err:= ws.UserRooms(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(all)
+
+	rooms:= make(protocol.RoomList, len(all))
+
+	for i, name:= range all{
+		rooms[i] = protocol.Room{
+			Name: name,
+			Joined: slices.Contains(joined, name),
+		}
+	}
+
+	return rooms, nil
+}
+
+// RoomsFrame wraps the room list for id so it can be written to the socket.
+func (ws * WsServer) RoomsFrame(ctx context.Context, id string) (protocol.MessageWrapper, error) {
+
+	rooms, err:= ws.ListRooms(ctx, id)
+
+	if err != nil {
+		return protocol.MessageWrapper{}, err
+	}
+
+	return protocol.Wrap(rooms)
+}
+
+// RoomsChannel tells every session of id that its memberships changed.
+func RoomsChannel(id string) string {
+	return "rooms:" + id
+}
+
+// HandleRoom applies a room action for id, then tells each of its sessions
+// to resubscribe through SyncRooms.
+func (ws * WsServer) HandleRoom(ctx context.Context, id string, room protocol.RoomMessage) error {
+
+	var err error
+
+	switch room.Action {
+
+	case "create":
+		err = ws.CreateRoom(ctx, id, room.Name)
+
+	case "join":
+		err = ws.JoinRoom(ctx, id, room.Name)
+
+	case "leave":
+		err = ws.LeaveRoom(ctx, id, room.Name)
+
+	case "list":
+
+	default:
+		err = Reject(protocol.CodeRoom, "Unknown room action: " + room.Action)
+	}
+
+	if pubErr:= ws.Redis.Publish(ctx, RoomsChannel(id), room.Name).Err(); pubErr != nil {
+		fmt.Println(pubErr)
+	}
+
+	return err
+}
+
+// SyncRooms brings sub in line with the rooms id currently belongs to.
+// joined holds the rooms sub is subscribed to and is updated in place.
+func (ws * WsServer) SyncRooms(ctx context.Context, id string, sub * redis.PubSub, joined map[string]bool) error {
+
+	rooms, err:= ws.UserRooms(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	current:= make(map[string]bool, len(rooms))
+
+	for _, room:= range rooms{
+
+		current[room] = true
+
+		if !joined[room] {
+
+			if err:= sub.Subscribe(ctx, RoomChannel(room)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for room:= range joined{
+
+		if !current[room] {
+
+			if err:= sub.Unsubscribe(ctx, RoomChannel(room)); err != nil {
+				return err
+			}
+		}
+	}
+
+	clear(joined)
+
+	for room:= range current{
+		joined[room] = true
+	}
+
+	return nil
+}
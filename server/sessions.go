@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// SessionPolicy decides what happens when an id that is already connected
+// connects again.
+type SessionPolicy string
+
+const (
+	// PolicyRefuse keeps the existing connection and closes the new one.
+	PolicyRefuse SessionPolicy = "refuse"
+	// PolicyTakeover keeps the new connection and kicks the existing one.
+	PolicyTakeover SessionPolicy = "takeover"
+	// PolicyMulti keeps every connection, one per device.
+	PolicyMulti SessionPolicy = "multi"
+)
+
+// Policy reads SESSION_POLICY, falling back to PolicyMulti.
+func Policy() SessionPolicy {
+
+	policy:= SessionPolicy(os.Getenv("SESSION_POLICY"))
+
+	switch policy {
+	case PolicyRefuse, PolicyTakeover, PolicyMulti:
+		return policy
+	case "":
+		return PolicyMulti
+	}
+
+	fmt.Println("Invalid SESSION_POLICY, using default:", policy)
+
+	return PolicyMulti
+}
+
+// sessionsKey holds the ids of every live session of a user.
+func sessionsKey(id string) string {
+	return "sessions:" + id
+}
+
+// SessionChannel carries the id of the session that now owns a user, so
+// the sessions it replaced can disconnect themselves.
+func SessionChannel(id string) string {
+	return "takeover:" + id
+}
+
+// UserChannel carries the chats, typing events and receipts for every
+// session of a user. The prefix keeps user names from ever naming one of
+// the server's own channels.
+func UserChannel(id string) string {
+	return "user:" + id
+}
+
+func NewSessionID() string {
+
+	buf:= make([] byte, 16)
+
+	if _, err:= rand.Read(buf); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+// claimFirstSession adds the session only when the user has none.
+var claimFirstSession = redis.NewScript(`
+if redis.call("SCARD", KEYS[1]) > 0 then
+	return 0
+end
+redis.call("SADD", KEYS[1], ARGV[1])
+return 1
+`)
+
+// replaceSessions makes the session the only one the user has.
+var replaceSessions = redis.NewScript(`
+redis.call("DEL", KEYS[1])
+redis.call("SADD", KEYS[1], ARGV[1])
+return 1
+`)
+
+// releaseSession removes the session and returns how many are left. When
+// it was the last one the user leaves the active set and is announced
+// offline in the same step, so a session claimed concurrently is never
+// mistaken for a stale one.
+var releaseSession = redis.NewScript(`
+redis.call("SREM", KEYS[1], ARGV[1])
+local remaining = redis.call("SCARD", KEYS[1])
+if remaining > 0 then
+	return remaining
+end
+redis.call("SREM", KEYS[2], ARGV[2])
+redis.call("HDEL", KEYS[3], ARGV[2])
+redis.call("HSET", KEYS[4], ARGV[2], ARGV[3])
+redis.call("DEL", KEYS[5])
+redis.call("PUBLISH", ARGV[5], ARGV[4])
+return 0
+`)
+
+// ClaimSession registers session for id according to the server's policy.
+// It returns false when the connection must be refused.
+func (ws * WsServer) ClaimSession(ctx context.Context, id string, session string) (bool, error) {
+
+	keys:= [] string{sessionsKey(id)}
+
+	switch ws.Policy {
+
+	case PolicyTakeover:
+		if err:= replaceSessions.Run(ctx, ws.Redis, keys, session).Err(); err != nil {
+			return false, err
+		}
+
+		return true, ws.Redis.Publish(ctx, SessionChannel(id), session).Err()
+
+	case PolicyRefuse:
+		claimed, err:= claimFirstSession.Run(ctx, ws.Redis, keys, session).Int()
+
+		return claimed == 1, err
+	}
+
+	return true, ws.Redis.SAdd(ctx, sessionsKey(id), session).Err()
+}
+
+// ReleaseSession drops session and returns how many sessions id still has.
+// The user only goes offline once the last one is released.
+func (ws * WsServer) ReleaseSession(ctx context.Context, id string, session string) (int, error) {
+
+	now:= time.Now().Unix()
+
+	payload, err:= ws.presencePayload(ctx, id, protocol.StateOffline, now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	keys:= [] string{sessionsKey(id), "active:channels", presenceStatesKey, lastSeenKey, presenceKey(id)}
+
+	return releaseSession.Run(ctx, ws.Redis, keys, session, id, now, payload, presenceUpdates).Int()
+}
+
+// CloseWith sends a close frame with code and reason, then drops the connection.
+func CloseWith(conn * websocket.Conn, code int, reason string) {
+
+	deadline:= time.Now().Add(time.Second)
+
+	if err:= conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline); err != nil {
+		fmt.Println(err)
+	}
+
+	conn.Close()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const defaultShutdownTimeout = 10 * time.Second
+
+// Connection is a live socket and the session it holds, kept so the server
+// can close it and clean up after it on shutdown.
+type Connection struct {
+	ID string
+	Session string
+	// Released is set by whoever releases the session, the handler or
+	// Drain, so the other does not release it again.
+	Released bool
+}
+
+// ShutdownTimeout reads how long shutdown may take from SHUTDOWN_TIMEOUT,
+// falling back to defaultShutdownTimeout when it is unset or invalid.
+func ShutdownTimeout() time.Duration {
+	return envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
+}
+
+// Track registers a connection until Untrack is called. It returns false
+// once the server is draining, in which case the connection must be closed.
+func (ws * WsServer) Track(conn * websocket.Conn, connection Connection) bool {
+
+	ws.connsMux.Lock()
+	defer ws.connsMux.Unlock()
+
+	if ws.draining {
+		return false
+	}
+
+	if ws.conns == nil {
+		ws.conns = make(map[*websocket.Conn] Connection)
+	}
+
+	ws.conns[conn] = connection
+	ws.handlers.Add(1)
+
+	return true
+}
+
+// Untrack must run after the connection has released its session.
+func (ws * WsServer) Untrack(conn * websocket.Conn){
+
+	ws.connsMux.Lock()
+	delete(ws.conns, conn)
+	ws.connsMux.Unlock()
+
+	ws.handlers.Done()
+}
+
+// TakeRelease claims the release of conn's session. It returns false if
+// the session was already released, or conn is not tracked.
+func (ws * WsServer) TakeRelease(conn * websocket.Conn) bool {
+
+	ws.connsMux.Lock()
+	defer ws.connsMux.Unlock()
+
+	connection, ok:= ws.conns[conn]
+
+	if !ok || connection.Released {
+		return false
+	}
+
+	connection.Released = true
+	ws.conns[conn] = connection
+
+	return true
+}
+
+func (ws * WsServer) Draining() bool {
+
+	ws.connsMux.Lock()
+	defer ws.connsMux.Unlock()
+
+	return ws.draining
+}
+
+// Drain stops new upgrades, tells every client the server is going away and
+// waits for their handlers to release their sessions. Sessions still held
+// when ctx expires are released here so no user is left marked online.
+func (ws * WsServer) Drain(ctx context.Context){
+
+	ws.connsMux.Lock()
+
+	ws.draining = true
+
+	open:= make(map[*websocket.Conn] Connection, len(ws.conns))
+
+	for conn, connection:= range ws.conns{
+		open[conn] = connection
+	}
+
+	ws.connsMux.Unlock()
+
+	fmt.Println("Draining", len(open), "connections")
+
+	for conn:= range open{
+		CloseWith(conn, websocket.CloseGoingAway, "Server going away")
+	}
+
+	finished:= make(chan struct{})
+
+	go func(){
+		ws.handlers.Wait()
+		close(finished)
+	}()
+
+	select {
+
+	case <- finished:
+		return
+
+	case <- ctx.Done():
+		fmt.Println("Shutdown deadline reached, releasing remaining sessions")
+	}
+
+	ws.connsMux.Lock()
+
+	stuck:= make([] Connection, 0, len(ws.conns))
+
+	for conn, connection:= range ws.conns{
+
+		if connection.Released {
+			continue
+		}
+
+		connection.Released = true
+		ws.conns[conn] = connection
+
+		stuck = append(stuck, connection)
+	}
+
+	ws.connsMux.Unlock()
+
+	for _, connection:= range stuck{
+
+		if _, err:= ws.ReleaseSession(context.Background(), connection.ID, connection.Session); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+// Reject builds an error the client is told about as is, under code.
+func Reject(code string, message string) error {
+
+	return protocol.ErrorMessage{
+		Code: code,
+		Message: message,
+	}
+}
+
+// ErrorFrame wraps err, raised while handling a frame of type kind, for the
+// client; clientID names the chat it was raised for, if any. Errors that
+// were not raised through Reject are reported as internal so server
+// details do not leak.
+func ErrorFrame(kind string, clientID string, err error) protocol.MessageWrapper {
+
+	rejected:= protocol.ErrorMessage{}
+
+	if !errors.As(err, &rejected) {
+		rejected = protocol.ErrorMessage{
+			Code: protocol.CodeInternal,
+			Message: "Something went wrong, try again",
+		}
+	}
+
+	rejected.Type = kind
+	rejected.ClientID = clientID
+
+	frame, wrapErr:= protocol.Wrap(rejected)
+
+	if wrapErr != nil {
+		fmt.Println(wrapErr)
+	}
+
+	return frame
+}
+
+// ErrRecipient rejects a recipient that cannot be a user, such as one
+// naming a channel of the server's.
+var ErrRecipient = Reject(protocol.CodeNoRecipient, "Recipients are 1-32 letters, digits, '-' or '_'")
+
+// control reports runes that could drive the recipient's terminal: C0 and
+// C1 control characters and DEL. Line breaks and tabs are only text.
+func control(r rune) bool {
+
+	if r == '\n' || r == '\t' {
+		return false
+	}
+
+	return r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0)
+}
+
+// ValidateChat checks a chat message from id and stamps it with id as the
+// sender, whatever the client claimed.
+func ValidateChat(id string, chat * protocol.ChatMessage) error {
+
+	chat.From = id
+	chat.ID = ""
+
+	if strings.TrimSpace(chat.Text) == ""{
+		return Reject(protocol.CodeEmptyText, "Message is empty")
+	}
+
+	if utf8.RuneCountInString(chat.Text) > protocol.MaxTextLength {
+		return Reject(protocol.CodeTooLong, fmt.Sprintf("Message is longer than %d characters", protocol.MaxTextLength))
+	}
+
+	if strings.ContainsFunc(chat.Text, control) {
+		return Reject(protocol.CodeControl, "Message has control characters")
+	}
+
+	if chat.To == "" && chat.Room == ""{
+		return Reject(protocol.CodeNoRecipient, "Message has no recipient")
+	}
+
+	if chat.Room == "" && !username.MatchString(chat.To) {
+		return ErrRecipient
+	}
+
+	if len(chat.ClientID) > maxClientIDLength {
+		return Reject(protocol.CodeInvalidFrame, "Message id is too long")
+	}
+
+	return nil
+}
+
+// ValidateTyping stamps a typing event with id as the sender.
+func ValidateTyping(id string, typing * protocol.TypingMessage) error {
+
+	typing.From = id
+
+	if typing.To == "" && typing.Room == ""{
+		return Reject(protocol.CodeNoRecipient, "Typing event has no recipient")
+	}
+
+	if typing.Room != "" {
+
+		if !roomName.MatchString(typing.Room) {
+			return ErrRoomName
+		}
+
+		return nil
+	}
+
+	if !username.MatchString(typing.To) {
+		return ErrRecipient
+	}
+
+	return nil
+}
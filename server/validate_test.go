@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Ikenna-Okpala/chatty/protocol"
+)
+
+func TestValidateChat(t * testing.T){
+
+	tests:= [] struct {
+		name string
+		chat protocol.ChatMessage
+		code string
+	}{
+		{"dm", protocol.ChatMessage{To: "bob", Text: "hi"}, ""},
+		{"room", protocol.ChatMessage{Room: "general", Text: "hi"}, ""},
+		{"empty", protocol.ChatMessage{To: "bob", Text: " \n\t"}, protocol.CodeEmptyText},
+		{"longest", protocol.ChatMessage{To: "bob", Text: strings.Repeat("é", protocol.MaxTextLength)}, ""},
+		{"too long", protocol.ChatMessage{To: "bob", Text: strings.Repeat("é", protocol.MaxTextLength + 1)}, protocol.CodeTooLong},
+		{"lines and tabs", protocol.ChatMessage{To: "bob", Text: "one\n\ttwo"}, ""},
+		{"escape sequence", protocol.ChatMessage{To: "bob", Text: "\x1b]52;c;aGk=\x07"}, protocol.CodeControl},
+		{"carriage return", protocol.ChatMessage{To: "bob", Text: "safe\rrm -rf"}, protocol.CodeControl},
+		{"c1 control", protocol.ChatMessage{To: "bob", Text: "\u009b31m"}, protocol.CodeControl},
+		{"no recipient", protocol.ChatMessage{Text: "hi"}, protocol.CodeNoRecipient},
+		{"takeover channel", protocol.ChatMessage{To: "takeover:bob", Text: "hi"}, protocol.CodeNoRecipient},
+		{"user channel", protocol.ChatMessage{To: "user:bob", Text: "hi"}, protocol.CodeNoRecipient},
+		{"recipient too long", protocol.ChatMessage{To: strings.Repeat("b", 33), Text: "hi"}, protocol.CodeNoRecipient},
+		{"client id too long", protocol.ChatMessage{To: "bob", Text: "hi", ClientID: strings.Repeat("x", maxClientIDLength + 1)}, protocol.CodeInvalidFrame},
+	}
+
+	for _, test:= range tests{
+
+		t.Run(test.name, func(t * testing.T){
+
+			chat:= test.chat
+			chat.From = "mallory"
+			chat.ID = "1-0"
+
+			err:= ValidateChat("alice", &chat)
+
+			if chat.From != "alice" {
+				t.Errorf("From = %q, want the sender alice", chat.From)
+			}
+
+			if chat.ID != "" {
+				t.Errorf("ID = %q, want it cleared", chat.ID)
+			}
+
+			if test.code == ""{
+
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			var rejected protocol.ErrorMessage
+
+			if !errors.As(err, &rejected) {
+				t.Fatalf("error = %v, want a rejection with code %s", err, test.code)
+			}
+
+			if rejected.Code != test.code {
+				t.Errorf("code = %s, want %s", rejected.Code, test.code)
+			}
+		})
+	}
+}